@@ -47,7 +47,17 @@ func (out *Carbon) Output() {
 	}
 
 	for mm := range out.measurements {
-		fmt.Fprintf(conn, "%s %s %d\n", mm.Name(prefix), mm.StrValue(), mm.Time().Unix())
+		name := mm.Name(prefix)
+		if tm, ok := mm.(TaggedMeasurement); ok {
+			// Graphite 1.1 tagged series: name;tag1=value1;tag2=value2
+			if tm.Source() != "" {
+				name += ";source=" + tm.Source()
+			}
+			for _, k := range tm.SortedTagKeys() {
+				name += ";" + k + "=" + tm.Tags()[k]
+			}
+		}
+		fmt.Fprintf(conn, "%s %s %d\n", name, mm.StrValue(), mm.Time().Unix())
 	}
 
 }
@@ -2,39 +2,262 @@ package shh
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/heroku/shh/filechan"
+	"github.com/heroku/slog"
 )
 
 const (
 	CGROUPS_PATH = "/sys/fs/cgroup"
 )
 
+var (
+	// container IDs, which are shortened to 12 characters, like docker ps
+	cgroupIdRegexp = regexp.MustCompile(`[0-9a-f]{64}`)
+	// systemd escapes characters in unit names, e.g. - as \x2d
+	cgroupEscapeRegexp = regexp.MustCompile(`\\x[0-9a-f]{2}`)
+	// what's left that can't be in a metric name, once unescaped
+	cgroupInvalidRegexp = regexp.MustCompile(`[^a-zA-Z0-9-]`)
+)
+
+// Memory pressure events reported, as the number since the last poll. On v1
+// only max, from memory.failcnt, and oom_kill, from memory.oom_control, are
+// available.
+var cgroupPressureEvents = []string{"high", "max", "oom", "oom_kill"}
+
+// The cpu and mem metrics are read from the cpuacct, cpu and memory
+// controllers on cgroup v1 hierarchies. Apart from mem.kernel and
+// mem.kernel.tcp they are also reported on the unified, v2, hierarchy, along
+// with cgroupV2Metrics.
+var cgroupMetrics = append([]MetricDescriptor{
+	{"cgroup.<cgroup>.cpu.user", FloatGaugeType, Percent, "CPU used in user mode, as a percentage of one core", ""},
+	{"cgroup.<cgroup>.cpu.system", FloatGaugeType, Percent, "CPU used in kernel mode, as a percentage of one core", ""},
+	{"cgroup.<cgroup>.cpu.throttled.count", GaugeType, Empty, "Enforcement periods the cgroup was throttled in since the last poll", ""},
+	{"cgroup.<cgroup>.cpu.throttled.seconds", FloatGaugeType, Seconds, "Time the cgroup was throttled for since the last poll", ""},
+	{"cgroup.<cgroup>.cpu.throttled.perc", FloatGaugeType, Percent, "Percentage of the enforcement periods since the last poll the cgroup was throttled in", ""},
+	{"cgroup.<cgroup>.mem.pressure.<event>", GaugeType, Empty, "Times the memory limits were hit, or OOM kills, since the last poll", ""},
+	{"cgroup.<cgroup>.mem.user", FloatGaugeType, Bytes, "Peak memory usage since the last poll", ""},
+	{"cgroup.<cgroup>.mem.kernel", FloatGaugeType, Bytes, "Peak kernel memory usage since the last poll", ""},
+	{"cgroup.<cgroup>.mem.kernel.tcp", FloatGaugeType, Bytes, "Peak kernel TCP buffer memory usage since the last poll", ""},
+}, cgroupV2Metrics...)
+
 type Cgroup struct {
 	measurements chan<- Measurement
-	last         map[string]uint64
+	last         map[string]map[string]uint64 // by cgroup, then metric
 	cgroups      []string
+	globs        []string
+	regexps      []*regexp.Regexp
+	path         string
 	// The kernel will report CPU usage in centiseconds.  This
 	// stores the total centiseconds in the polling interval.
 	totalCentis uint64
+	// cgroup v2 reports CPU usage in microseconds instead
+	totalMicros uint64
+	unified     bool
+	// samples memory usage when SHH_CGROUP_READ_ONLY is set
+	sampler *cgroupSampler
 }
 
 func NewCgroupPoller(measurements chan<- Measurement, config Config) Cgroup {
-	return Cgroup{
+	poller := Cgroup{
 		measurements: measurements,
-		last:         make(map[string]uint64),
-		cgroups:      config.Cgroups,
+		last:         make(map[string]map[string]uint64),
+		path:         config.sysPath(CGROUPS_PATH),
 		// convert the interval to centiseconds
 		totalCentis: uint64(config.Interval.Nanoseconds() / 10000000),
+		totalMicros: uint64(config.Interval.Nanoseconds() / 1000),
+		unified:     isCgroupV2(config.sysPath(CGROUPS_PATH)),
+	}
+
+	for _, cgroup := range config.Cgroups {
+		switch {
+		case strings.HasPrefix(cgroup, REGEXP_PREFIX):
+			re, err := compilePatternRegexp(cgroup)
+			if err != nil {
+				LogError(slog.Context{"poller": poller.Name(), "fn": "NewCgroupPoller", "cgroup": cgroup}, err, "compiling regexp")
+				continue
+			}
+			poller.regexps = append(poller.regexps, re)
+		case isGlob(cgroup):
+			poller.globs = append(poller.globs, cgroup)
+		default:
+			poller.cgroups = append(poller.cgroups, cgroup)
+		}
 	}
+
+	if config.CgroupReadOnly {
+		if poller.unified {
+			poller.sampler = newCgroupSampler(poller.path, cgroupV2SampledFiles, config.CgroupSampleInterval)
+		} else {
+			poller.sampler = newCgroupSampler(filepath.Join(poller.path, "memory"), cgroupV1SampledFiles, config.CgroupSampleInterval)
+		}
+	}
+
+	return poller
 }
 
 func sanitizeMetricName(name string) string {
 	return strings.Replace(strings.Replace(name, ".", "-", -1), "/", "--", -1)
 }
 
+// metricName names cgroup in metrics. Those found by discovery also have
+// systemd's escapes undone and container IDs shortened, with anything that
+// then can't be in a metric name replaced by -.
+func (poller Cgroup) metricName(cgroup string) string {
+	if SliceContainsString(poller.cgroups, cgroup) {
+		return sanitizeMetricName(cgroup)
+	}
+
+	name := cgroupEscapeRegexp.ReplaceAllStringFunc(cgroup, func(escaped string) string {
+		c, _ := strconv.ParseUint(escaped[2:], 16, 8)
+		return string(rune(c))
+	})
+	name = cgroupIdRegexp.ReplaceAllStringFunc(name, func(id string) string {
+		return id[:12]
+	})
+	return cgroupInvalidRegexp.ReplaceAllString(sanitizeMetricName(name), "-")
+}
+
+// hierarchy returns the directory cgroups are discovered in: the unified
+// hierarchy, or the cpuacct controller's on v1.
+func (poller Cgroup) hierarchy() string {
+	if poller.unified {
+		return poller.path
+	}
+	return filepath.Join(poller.path, "cpuacct")
+}
+
+// exists reports whether cgroup currently exists, in any of the controllers
+// read on v1.
+func (poller Cgroup) exists(cgroup string) bool {
+	if poller.unified {
+		return Exists(filepath.Join(poller.path, cgroup))
+	}
+	for _, controller := range []string{"cpuacct", "cpu", "memory"} {
+		if Exists(filepath.Join(poller.path, controller, cgroup)) {
+			return true
+		}
+	}
+	return false
+}
+
+// discover returns the cgroups to poll: those named in SHH_CGROUPS, followed
+// by those currently matching its globs and regexps, sorted.
+func (poller Cgroup) discover() []string {
+	ctx := slog.Context{"poller": poller.Name(), "fn": "discover"}
+	base := poller.hierarchy()
+	found := make(map[string]bool)
+
+	for _, glob := range poller.globs {
+		matches, err := filepath.Glob(filepath.Join(base, glob))
+		if err != nil {
+			LogError(ctx, err, "matching "+glob)
+			continue
+		}
+		for _, match := range matches {
+			if fi, err := os.Stat(match); err == nil && fi.IsDir() {
+				if rel, err := filepath.Rel(base, match); err == nil {
+					found[rel] = true
+				}
+			}
+		}
+	}
+
+	if len(poller.regexps) > 0 {
+		filepath.Walk(base, func(path string, fi os.FileInfo, err error) error {
+			// cgroups can go away while we walk, so skip anything we can't read
+			if err != nil || !fi.IsDir() || path == base {
+				return nil
+			}
+			rel, err := filepath.Rel(base, path)
+			if err != nil {
+				return nil
+			}
+			for _, re := range poller.regexps {
+				if re.MatchString(rel) {
+					found[rel] = true
+				}
+			}
+			return nil
+		})
+	}
+
+	discovered := make([]string, 0, len(found))
+	for cgroup := range found {
+		if !SliceContainsString(poller.cgroups, cgroup) {
+			discovered = append(discovered, cgroup)
+		}
+	}
+	sort.Strings(discovered)
+
+	return append(append([]string{}, poller.cgroups...), discovered...)
+}
+
+// lastValue records value as the last of metric for cgroup, returning the
+// one it replaced, if any.
+func (poller Cgroup) lastValue(cgroup, metric string, value uint64) (uint64, bool) {
+	metrics, ok := poller.last[cgroup]
+	if !ok {
+		metrics = make(map[string]uint64)
+		poller.last[cgroup] = metrics
+	}
+	last, exists := metrics[metric]
+	metrics[metric] = value
+	return last, exists
+}
+
+// delta records value as the last of the counter metric for cgroup,
+// returning how much it has grown by since the last poll. It returns false
+// on the first poll, or if the counter went backwards.
+func (poller Cgroup) delta(cgroup, metric string, value uint64) (uint64, bool) {
+	last, exists := poller.lastValue(cgroup, metric, value)
+	if !exists || value < last {
+		return 0, false
+	}
+	return value - last, true
+}
+
+// handleThrottling emits how much cgroup was throttled since the last poll
+// from the counters in its cpu.stat. throttledNanos is the time throttled,
+// in nanoseconds.
+func (poller Cgroup) handleThrottling(tick time.Time, cgroup string, periods, throttled, throttledNanos uint64) {
+	name := poller.metricName(cgroup)
+
+	periodsDelta, ok := poller.delta(cgroup, "nr_periods", periods)
+	throttledDelta, _ := poller.delta(cgroup, "nr_throttled", throttled)
+	timeDelta, _ := poller.delta(cgroup, "throttled_time", throttledNanos)
+	if !ok {
+		return
+	}
+
+	poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{name, "cpu", "throttled", "count"}, throttledDelta, Empty}
+	poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{name, "cpu", "throttled", "seconds"}, float64(timeDelta) / float64(time.Second), Seconds}
+	if periodsDelta > 0 {
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{name, "cpu", "throttled", "perc"}, 100.0 * float64(throttledDelta) / float64(periodsDelta), Percent}
+	}
+}
+
+// handlePressure emits how many of each memory pressure event cgroup has
+// had since the last poll, from the cumulative counts in events.
+func (poller Cgroup) handlePressure(tick time.Time, cgroup string, events map[string]uint64) {
+	for _, event := range cgroupPressureEvents {
+		count, ok := events[event]
+		if !ok {
+			continue
+		}
+		if delta, ok := poller.delta(cgroup, "pressure."+event, count); ok {
+			poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{poller.metricName(cgroup), "mem", "pressure", event}, delta, Empty}
+		}
+	}
+}
+
 // handlePercentCpu parses a line from cpuacct.stat like "user 12345678",
 // calculates the delta from the last measurement, calculates the
 // average percentage of one CPU core used, and submits the data point.
@@ -47,28 +270,25 @@ func (poller Cgroup) handlePercentCpu(line string, tick time.Time, cgroup string
 	// absolute number of centiseconds of CPU time used
 	centis := Atouint64(fields[1])
 
-	key := cgroup + "." + metric
-	last, exists := poller.last[key]
+	last, exists := poller.lastValue(cgroup, metric, centis)
 
 	if exists {
 		delta := centis - last
 		percent := float64(delta) * 100.0 / float64(poller.totalCentis)
 
-		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{sanitizeMetricName(cgroup), "cpu", metric}, percent, Percent}
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{poller.metricName(cgroup), "cpu", metric}, percent, Percent}
 	}
-
-	poller.last[key] = centis
 }
 
 // handleMaxMemory reads one kind of memory high-water mark, emits a metric,
 // and resets the HWM for the next interval.
 func (poller Cgroup) handleMaxMemory(metric string, fileName string, tick time.Time, cgroup string) {
-	path := CGROUPS_PATH + "/memory/" + cgroup + "/" + fileName
+	path := poller.path + "/memory/" + cgroup + "/" + fileName
 	data, err := ioutil.ReadFile(path)
 
 	if err == nil {
 		maxBytes := Atofloat64(strings.TrimSpace(string(data)))
-		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{sanitizeMetricName(cgroup), "mem", metric}, maxBytes, Bytes}
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{poller.metricName(cgroup), "mem", metric}, maxBytes, Bytes}
 
 		// reset the high water mark
 		ioutil.WriteFile(path, []byte("0"), 0644)
@@ -76,11 +296,31 @@ func (poller Cgroup) handleMaxMemory(metric string, fileName string, tick time.T
 }
 
 func (poller Cgroup) Poll(tick time.Time) {
-	for _, cgroup := range poller.cgroups {
+	cgroups := poller.discover()
+
+	// forget the counters of cgroups that have gone away, so they don't
+	// build up, or produce bogus deltas if a cgroup of the same name returns
+	for cgroup := range poller.last {
+		if !SliceContainsString(cgroups, cgroup) || !poller.exists(cgroup) {
+			delete(poller.last, cgroup)
+		}
+	}
+
+	var peaks map[string]map[string]uint64
+	if poller.sampler != nil {
+		peaks = poller.sampler.take(cgroups)
+	}
+
+	for _, cgroup := range cgroups {
+		if poller.unified {
+			poller.pollV2(tick, cgroup, peaks)
+			continue
+		}
+
 		// I can't use the FileLineChannel in utils.go here because I
 		// don't want to raise a fatal error if the cgroup doesn't exist yet.
 
-		cpuStat, err := filechan.FileLineChannel(CGROUPS_PATH + "/cpuacct/" + cgroup + "/cpuacct.stat")
+		cpuStat, err := filechan.FileLineChannel(poller.path + "/cpuacct/" + cgroup + "/cpuacct.stat")
 
 		if err == nil {
 			for line := range cpuStat {
@@ -88,9 +328,28 @@ func (poller Cgroup) Poll(tick time.Time) {
 			}
 		}
 
-		poller.handleMaxMemory("user", "memory.max_usage_in_bytes", tick, cgroup)
-		poller.handleMaxMemory("kernel", "memory.kmem.max_usage_in_bytes", tick, cgroup)
-		poller.handleMaxMemory("kernel.tcp", "memory.kmem.tcp.max_usage_in_bytes", tick, cgroup)
+		if cpu, err := readKeyValues(filepath.Join(poller.path, "cpu", cgroup, "cpu.stat")); err == nil {
+			poller.handleThrottling(tick, cgroup, cpu["nr_periods"], cpu["nr_throttled"], cpu["throttled_time"])
+		}
+
+		if poller.sampler != nil {
+			poller.handleSampledMemory(tick, cgroup, peaks[cgroup])
+		} else {
+			poller.handleMaxMemory("user", "memory.max_usage_in_bytes", tick, cgroup)
+			poller.handleMaxMemory("kernel", "memory.kmem.max_usage_in_bytes", tick, cgroup)
+			poller.handleMaxMemory("kernel.tcp", "memory.kmem.tcp.max_usage_in_bytes", tick, cgroup)
+		}
+
+		events := make(map[string]uint64)
+		if failcnt, err := readUint64(filepath.Join(poller.path, "memory", cgroup, "memory.failcnt")); err == nil {
+			events["max"] = failcnt
+		}
+		if oom, err := readKeyValues(filepath.Join(poller.path, "memory", cgroup, "memory.oom_control")); err == nil {
+			if kills, ok := oom["oom_kill"]; ok {
+				events["oom_kill"] = kills
+			}
+		}
+		poller.handlePressure(tick, cgroup, events)
 	}
 }
 
@@ -98,4 +357,8 @@ func (poller Cgroup) Name() string {
 	return "cgroup"
 }
 
-func (poller Cgroup) Exit() {}
+func (poller Cgroup) Exit() {
+	if poller.sampler != nil {
+		poller.sampler.stop()
+	}
+}
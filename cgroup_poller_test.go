@@ -0,0 +1,185 @@
+package shh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCgroupPoller_V2(t *testing.T) {
+	root := newFixture(t, map[string]string{
+		"fs/cgroup/cgroup.controllers":                      "cpu io memory pids\n",
+		"fs/cgroup/system.slice/web.service/cpu.stat":       "usage_usec 1000000\nuser_usec 800000\nsystem_usec 200000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 5000\n",
+		"fs/cgroup/system.slice/web.service/memory.current": "1048576\n",
+		"fs/cgroup/system.slice/web.service/memory.stat":    "anon 4096\nfile 8192\npgmajfault 3\nunknown 1\n",
+		"fs/cgroup/system.slice/web.service/memory.events":  "low 0\nhigh 1\nmax 2\noom 0\noom_kill 1\n",
+		"fs/cgroup/system.slice/web.service/io.stat":        "8:0 rbytes=100 wbytes=200 rios=1 wios=2 dbytes=0 dios=0\n8:16 rbytes=10 wbytes=20 rios=1 wios=1 dbytes=0 dios=0\n",
+		"fs/cgroup/system.slice/web.service/pids.current":   "7\n",
+	})
+
+	config := Config{SysRoot: root, Interval: time.Second, Cgroups: []string{"system.slice/web.service", "missing.service"}}
+	poller := NewCgroupPoller(nil, config)
+	if !poller.unified {
+		t.Fatalf("Should have detected the unified hierarchy")
+	}
+	poll := func() map[string]string {
+		return pollValues(t, func(measurements chan<- Measurement) {
+			poller.measurements = measurements
+			poller.Poll(time.Now())
+		})
+	}
+
+	poll()
+	writeFixture(t, root, map[string]string{
+		"fs/cgroup/system.slice/web.service/cpu.stat": "usage_usec 1500000\nuser_usec 1200000\nsystem_usec 300000\nnr_periods 20\nnr_throttled 5\nthrottled_usec 9000\n",
+	})
+	values := poll()
+
+	expected := map[string]string{
+		"cgroup.system-slice--web-service.cpu.usage":             "50.000000",
+		"cgroup.system-slice--web-service.cpu.user":              "40.000000",
+		"cgroup.system-slice--web-service.cpu.system":            "10.000000",
+		"cgroup.system-slice--web-service.cpu.throttled.periods": "5",
+		"cgroup.system-slice--web-service.cpu.throttled.time":    "9000",
+		"cgroup.system-slice--web-service.mem.current":           "1048576",
+		"cgroup.system-slice--web-service.mem.stat.anon":         "4096",
+		"cgroup.system-slice--web-service.mem.stat.pgmajfault":   "3",
+		"cgroup.system-slice--web-service.mem.events.oom-kill":   "1",
+		"cgroup.system-slice--web-service.io.read.bytes":         "110",
+		"cgroup.system-slice--web-service.io.write.ops":          "3",
+		"cgroup.system-slice--web-service.pids.current":          "7",
+		"cgroup.system-slice--web-service.cpu.throttled.count":   "3",
+		"cgroup.system-slice--web-service.cpu.throttled.seconds": "0.004000",
+		"cgroup.system-slice--web-service.cpu.throttled.perc":    "30.000000",
+		"cgroup.system-slice--web-service.mem.pressure.oom-kill": "0",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+
+	for _, name := range []string{"cgroup.system-slice--web-service.mem.peak", "cgroup.system-slice--web-service.mem.stat.unknown", "cgroup.system-slice--web-service.mem.user"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("Should not have reported %s", name)
+		}
+	}
+}
+
+func TestCgroupPoller_Discovery(t *testing.T) {
+	id := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	cpuStat := "usage_usec 1000\nuser_usec 800\nsystem_usec 200\n"
+	root := newFixture(t, map[string]string{
+		"fs/cgroup/cgroup.controllers":                              "cpu memory\n",
+		"fs/cgroup/system.slice/web.service/cpu.stat":               cpuStat,
+		"fs/cgroup/system.slice/worker.service/cpu.stat":            cpuStat,
+		"fs/cgroup/system.slice/dev-disk-by\\x2duuid.swap/cpu.stat": cpuStat,
+		"fs/cgroup/system.slice/docker-" + id + ".scope/cpu.stat":   cpuStat,
+		"fs/cgroup/user.slice/cpu.stat":                             cpuStat,
+	})
+
+	config := Config{SysRoot: root, Interval: time.Second, Cgroups: []string{"user.slice", "system.slice/*.service", `re:system\.slice/(docker-[0-9a-f]+\.scope|.*\.swap)`}}
+	poller := NewCgroupPoller(make(chan Measurement, 100), config)
+
+	expected := []string{"user.slice", "system.slice/dev-disk-by\\x2duuid.swap", "system.slice/docker-" + id + ".scope", "system.slice/web.service", "system.slice/worker.service"}
+	cgroups := poller.discover()
+	if len(cgroups) != len(expected) {
+		t.Fatalf("Should have discovered %v, got %v", expected, cgroups)
+	}
+	for i := range expected {
+		if cgroups[i] != expected[i] {
+			t.Errorf("Should have discovered %s, got %s", expected[i], cgroups[i])
+		}
+	}
+
+	names := map[string]string{
+		"user.slice":                             "user-slice",
+		"system.slice/docker-" + id + ".scope":   "system-slice--docker-0123456789ab-scope",
+		"system.slice/dev-disk-by\\x2duuid.swap": "system-slice--dev-disk-by-uuid-swap",
+		"system.slice/my\\x20app.service":        "system-slice--my-app-service",
+	}
+	for cgroup, name := range names {
+		if got := poller.metricName(cgroup); got != name || !MetricNameRegexp.MatchString("cgroup."+got) {
+			t.Errorf("Should have named %s %s, got %s", cgroup, name, got)
+		}
+	}
+
+	// cgroups named in SHH_CGROUPS keep the names they've always had
+	named := Cgroup{cgroups: []string{"docker/" + id}}
+	if got := named.metricName("docker/" + id); got != "docker--"+id {
+		t.Errorf("Should not have shortened the ID of a named cgroup, got %s", got)
+	}
+
+	poller.Poll(time.Now())
+	if _, ok := poller.last["system.slice/worker.service"]; !ok {
+		t.Fatalf("Should have recorded the last values of worker.service")
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "fs/cgroup/system.slice/worker.service")); err != nil {
+		t.Fatal(err)
+	}
+	poller.Poll(time.Now())
+	if _, ok := poller.last["system.slice/worker.service"]; ok {
+		t.Errorf("Should have dropped the last values of worker.service once it went away")
+	}
+	if _, ok := poller.last["system.slice/web.service"]; !ok {
+		t.Errorf("Should have kept the last values of web.service")
+	}
+}
+
+func TestCgroupPoller_ReadOnly(t *testing.T) {
+	root := newFixture(t, map[string]string{
+		"fs/cgroup/memory/app/memory.usage_in_bytes":     "1000\n",
+		"fs/cgroup/memory/app/memory.max_usage_in_bytes": "9000\n",
+		"fs/cgroup/memory/app/memory.failcnt":            "4\n",
+		"fs/cgroup/memory/app/memory.oom_control":        "oom_kill_disable 0\nunder_oom 0\noom_kill 1\n",
+		"fs/cgroup/cpu/app/cpu.stat":                     "nr_periods 100\nnr_throttled 10\nthrottled_time 2000000000\n",
+	})
+
+	measurements := make(chan Measurement, 100)
+	config := Config{SysRoot: root, Interval: time.Second, Cgroups: []string{"app"}, CgroupReadOnly: true, CgroupSampleInterval: 5 * time.Millisecond}
+	poller := NewCgroupPoller(measurements, config)
+	defer poller.Exit()
+
+	poller.Poll(time.Now())
+	writeFixture(t, root, map[string]string{
+		"fs/cgroup/memory/app/memory.usage_in_bytes": "5000\n",
+		"fs/cgroup/memory/app/memory.failcnt":        "6\n",
+		"fs/cgroup/cpu/app/cpu.stat":                 "nr_periods 200\nnr_throttled 60\nthrottled_time 3500000000\n",
+	})
+	time.Sleep(50 * time.Millisecond)
+	writeFixture(t, root, map[string]string{
+		"fs/cgroup/memory/app/memory.usage_in_bytes": "2000\n",
+	})
+	for len(measurements) > 0 {
+		<-measurements
+	}
+
+	poller.Poll(time.Now())
+	close(measurements)
+
+	values := make(map[string]string)
+	for mm := range measurements {
+		values[mm.Name("")] = mm.StrValue()
+	}
+
+	expected := map[string]string{
+		"cgroup.app.mem.user":              "5000.000000",
+		"cgroup.app.mem.pressure.max":      "2",
+		"cgroup.app.mem.pressure.oom-kill": "0",
+		"cgroup.app.cpu.throttled.count":   "50",
+		"cgroup.app.cpu.throttled.seconds": "1.500000",
+		"cgroup.app.cpu.throttled.perc":    "50.000000",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+
+	if data, _ := ioutil.ReadFile(filepath.Join(root, "fs/cgroup/memory/app/memory.max_usage_in_bytes")); string(data) != "9000\n" {
+		t.Errorf("Should not have reset the high-water mark, got %q", data)
+	}
+}
@@ -0,0 +1,110 @@
+package shh
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Files sampled for each kind of memory usage, relative to the cgroup
+var (
+	cgroupV1SampledFiles = map[string]string{
+		"user":       "memory.usage_in_bytes",
+		"kernel":     "memory.kmem.usage_in_bytes",
+		"kernel.tcp": "memory.kmem.tcp.usage_in_bytes",
+	}
+	cgroupV2SampledFiles = map[string]string{
+		"user": "memory.current",
+	}
+	cgroupSampledMetrics = []string{"user", "kernel", "kernel.tcp"}
+)
+
+// cgroupSampler tracks the peak memory usage of cgroups by sampling it
+// between polls, rather than reading the kernel's high-water marks and
+// resetting them, which needs write access to cgroupfs and breaks anything
+// else watching them.
+type cgroupSampler struct {
+	sync.Mutex
+	dir     string            // directory holding the cgroups
+	files   map[string]string // by metric
+	cgroups []string
+	peaks   map[string]map[string]uint64 // by cgroup, then metric
+	done    chan struct{}
+}
+
+func newCgroupSampler(dir string, files map[string]string, interval time.Duration) *cgroupSampler {
+	sampler := &cgroupSampler{
+		dir:   dir,
+		files: files,
+		peaks: make(map[string]map[string]uint64),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sampler.Lock()
+				sampler.sample()
+				sampler.Unlock()
+			case <-sampler.done:
+				return
+			}
+		}
+	}()
+
+	return sampler
+}
+
+// sample reads the current memory usage of the cgroups, raising their peaks.
+// Callers must hold the lock.
+func (sampler *cgroupSampler) sample() {
+	for _, cgroup := range sampler.cgroups {
+		for metric, file := range sampler.files {
+			usage, err := readUint64(filepath.Join(sampler.dir, cgroup, file))
+			if err != nil {
+				continue
+			}
+
+			peaks, ok := sampler.peaks[cgroup]
+			if !ok {
+				peaks = make(map[string]uint64)
+				sampler.peaks[cgroup] = peaks
+			}
+			if usage > peaks[metric] {
+				peaks[metric] = usage
+			}
+		}
+	}
+}
+
+// take samples cgroups one last time and returns the peaks since the last
+// call, starting afresh for cgroups, which are sampled from then on.
+func (sampler *cgroupSampler) take(cgroups []string) map[string]map[string]uint64 {
+	sampler.Lock()
+	defer sampler.Unlock()
+
+	sampler.cgroups = cgroups
+	sampler.sample()
+
+	peaks := sampler.peaks
+	sampler.peaks = make(map[string]map[string]uint64)
+	return peaks
+}
+
+func (sampler *cgroupSampler) stop() {
+	close(sampler.done)
+}
+
+// handleSampledMemory emits the peak memory usage of cgroup since the last
+// poll, as sampled.
+func (poller Cgroup) handleSampledMemory(tick time.Time, cgroup string, peaks map[string]uint64) {
+	for _, metric := range cgroupSampledMetrics {
+		if peak, ok := peaks[metric]; ok {
+			poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{poller.metricName(cgroup), "mem", metric}, float64(peak), Bytes}
+		}
+	}
+}
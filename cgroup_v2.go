@@ -0,0 +1,174 @@
+package shh
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	CGROUP_V2_CONTROLLERS = "cgroup.controllers"
+)
+
+// Fields of memory.stat reported on the unified hierarchy
+var (
+	cgroupV2MemoryStatGauges   = []string{"anon", "file", "kernel", "kernel_stack", "slab", "sock", "shmem", "file_mapped", "file_dirty", "file_writeback"}
+	cgroupV2MemoryStatCounters = []string{"pgfault", "pgmajfault", "workingset_refault_anon", "workingset_refault_file"}
+	cgroupV2MemoryEvents       = []string{"low", "high", "max", "oom", "oom_kill", "oom_group_kill"}
+)
+
+var cgroupV2Metrics = []MetricDescriptor{
+	{"cgroup.<cgroup>.cpu.usage", FloatGaugeType, Percent, "CPU used, as a percentage of one core (cgroup v2)", ""},
+	{"cgroup.<cgroup>.cpu.periods", CounterType, Empty, "Enforcement periods of the CPU limit (cgroup v2)", ""},
+	{"cgroup.<cgroup>.cpu.throttled.periods", CounterType, Empty, "Periods the cgroup was throttled in (cgroup v2)", ""},
+	{"cgroup.<cgroup>.cpu.throttled.time", CounterType, MicroSeconds, "Time the cgroup was throttled for (cgroup v2)", ""},
+	{"cgroup.<cgroup>.mem.current", GaugeType, Bytes, "Memory usage (cgroup v2)", ""},
+	{"cgroup.<cgroup>.mem.peak", GaugeType, Bytes, "Peak memory usage since the cgroup was created (cgroup v2)", ""},
+	{"cgroup.<cgroup>.mem.stat.<field>", GaugeType, Bytes, "Memory usage by type, from memory.stat (cgroup v2)", ""},
+	{"cgroup.<cgroup>.mem.stat.<field>", CounterType, Empty, "Page faults and refaults, from memory.stat (cgroup v2)", ""},
+	{"cgroup.<cgroup>.mem.events.<event>", CounterType, Empty, "Times the memory limits were hit and OOM kills, from memory.events (cgroup v2)", ""},
+	{"cgroup.<cgroup>.io.read.bytes", CounterType, Bytes, "Bytes read, across all devices (cgroup v2)", ""},
+	{"cgroup.<cgroup>.io.write.bytes", CounterType, Bytes, "Bytes written, across all devices (cgroup v2)", ""},
+	{"cgroup.<cgroup>.io.discard.bytes", CounterType, Bytes, "Bytes discarded, across all devices (cgroup v2)", ""},
+	{"cgroup.<cgroup>.io.read.ops", CounterType, Ops, "Reads, across all devices (cgroup v2)", ""},
+	{"cgroup.<cgroup>.io.write.ops", CounterType, Ops, "Writes, across all devices (cgroup v2)", ""},
+	{"cgroup.<cgroup>.io.discard.ops", CounterType, Ops, "Discards, across all devices (cgroup v2)", ""},
+	{"cgroup.<cgroup>.pids.current", GaugeType, Processes, "Processes and threads in the cgroup (cgroup v2)", ""},
+}
+
+// isCgroupV2 reports whether the hierarchy mounted at path is the unified,
+// cgroup v2, one.
+func isCgroupV2(path string) bool {
+	return Exists(filepath.Join(path, CGROUP_V2_CONTROLLERS))
+}
+
+// readKeyValues reads a flat keyed file, like cpu.stat, with a "key value"
+// pair on each line.
+func readKeyValues(path string) (map[string]uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			values[fields[0]] = Atouint64(fields[1])
+		}
+	}
+	return values, nil
+}
+
+// readIOStat reads io.stat, summing each key across devices. Lines look like
+// "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0".
+func readIOStat(path string) (map[string]uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+				values[kv[0]] += Atouint64(kv[1])
+			}
+		}
+	}
+	return values, nil
+}
+
+// readUint64 reads a file holding a single value, like memory.current
+func readUint64(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return Atouint64(strings.TrimSpace(string(data))), nil
+}
+
+// pollV2 reports on a cgroup in the unified hierarchy. As with v1, files that
+// can't be read, because the cgroup doesn't exist yet or the controller
+// isn't enabled for it, are silently skipped.
+func (poller Cgroup) pollV2(tick time.Time, cgroup string, peaks map[string]map[string]uint64) {
+	dir := filepath.Join(poller.path, cgroup)
+	name := poller.metricName(cgroup)
+
+	if cpu, err := readKeyValues(filepath.Join(dir, "cpu.stat")); err == nil {
+		poller.handlePercentCpuV2(tick, cgroup, "usage", cpu["usage_usec"])
+		poller.handlePercentCpuV2(tick, cgroup, "user", cpu["user_usec"])
+		poller.handlePercentCpuV2(tick, cgroup, "system", cpu["system_usec"])
+
+		if periods, ok := cpu["nr_periods"]; ok {
+			poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "cpu", "periods"}, periods, Empty}
+			poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "cpu", "throttled", "periods"}, cpu["nr_throttled"], Empty}
+			poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "cpu", "throttled", "time"}, cpu["throttled_usec"], MicroSeconds}
+			poller.handleThrottling(tick, cgroup, periods, cpu["nr_throttled"], cpu["throttled_usec"]*1000)
+		}
+	}
+
+	if current, err := readUint64(filepath.Join(dir, "memory.current")); err == nil {
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{name, "mem", "current"}, current, Bytes}
+	}
+
+	if poller.sampler != nil {
+		poller.handleSampledMemory(tick, cgroup, peaks[cgroup])
+	}
+
+	// memory.peak is only available from Linux 5.19
+	if peak, err := readUint64(filepath.Join(dir, "memory.peak")); err == nil {
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{name, "mem", "peak"}, peak, Bytes}
+	}
+
+	if stat, err := readKeyValues(filepath.Join(dir, "memory.stat")); err == nil {
+		for _, field := range cgroupV2MemoryStatGauges {
+			if value, ok := stat[field]; ok {
+				poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{name, "mem", "stat", field}, value, Bytes}
+			}
+		}
+		for _, field := range cgroupV2MemoryStatCounters {
+			if value, ok := stat[field]; ok {
+				poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "mem", "stat", field}, value, Empty}
+			}
+		}
+	}
+
+	if events, err := readKeyValues(filepath.Join(dir, "memory.events")); err == nil {
+		for _, event := range cgroupV2MemoryEvents {
+			if value, ok := events[event]; ok {
+				poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "mem", "events", event}, value, Empty}
+			}
+		}
+		poller.handlePressure(tick, cgroup, events)
+	}
+
+	if io, err := readIOStat(filepath.Join(dir, "io.stat")); err == nil {
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "read", "bytes"}, io["rbytes"], Bytes}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "write", "bytes"}, io["wbytes"], Bytes}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "discard", "bytes"}, io["dbytes"], Bytes}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "read", "ops"}, io["rios"], Ops}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "write", "ops"}, io["wios"], Ops}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "discard", "ops"}, io["dios"], Ops}
+	}
+
+	if pids, err := readUint64(filepath.Join(dir, "pids.current")); err == nil {
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{name, "pids", "current"}, pids, Processes}
+	}
+}
+
+// handlePercentCpuV2 calculates the average percentage of one CPU core used
+// since the last poll from a microsecond counter in cpu.stat.
+func (poller Cgroup) handlePercentCpuV2(tick time.Time, cgroup, metric string, micros uint64) {
+	last, exists := poller.lastValue(cgroup, metric, micros)
+
+	if exists && micros >= last {
+		percent := float64(micros-last) * 100.0 / float64(poller.totalMicros)
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{poller.metricName(cgroup), "cpu", metric}, percent, Percent}
+	}
+}
@@ -0,0 +1,328 @@
+// Package client sends measurements to the listen poller of a running shh.
+//
+//	c, err := client.New("unix,#shh", 0)
+//	...
+//	defer c.Close()
+//	c.Gauge("queue.depth", 12, "")
+//	c.Timing("backup.duration", time.Since(start))
+//
+// Measurements are buffered and written by a background goroutine, which
+// connects, and reconnects, as needed. Calls never block: when the buffer is
+// full, the measurement is dropped and counted (see Dropped).
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DEFAULT_ADDR            = "unix,#shh"      // Address of a listening shh (<net>,<addr>)
+	DEFAULT_BUFFER_SIZE     = 1000             // Measurements buffered while shh is unreachable
+	DEFAULT_RECONNECT_DELAY = time.Second      // Delay before the first reconnect attempt
+	MAX_RECONNECT_DELAY     = 30 * time.Second // Longest delay between reconnect attempts
+	DEFAULT_CLOSE_TIMEOUT   = 5 * time.Second  // Longest Close waits for the buffer to flush
+	WRITE_TIMEOUT           = 5 * time.Second  // Deadline for each write to shh
+	MAX_BATCH_SIZE          = 100              // Most lines sent in a single write
+)
+
+var (
+	MetricNameRegexp = regexp.MustCompile("^[a-zA-Z0-9]([a-zA-Z0-9.-]+)?$")
+	UnitRegexp       = regexp.MustCompile("^([a-zA-Z$%#]+)(,([a-zA-Z$%#]+))?$") // <unit 1>,<abbr 3>
+
+	ErrClosed = errors.New("client is closed")
+)
+
+// ValidateName returns an error if name isn't a metric name shh accepts
+func ValidateName(name string) error {
+	if !MetricNameRegexp.MatchString(name) {
+		return fmt.Errorf("%q is an improper metric name", name)
+	}
+	return nil
+}
+
+// ValidateUnit returns an error if unit, <unit>[,<abbr>], isn't one shh
+// accepts. An empty unit is valid.
+func ValidateUnit(unit string) error {
+	if unit != "" && !UnitRegexp.MatchString(unit) {
+		return fmt.Errorf("invalid unit specified in: %q", unit)
+	}
+	return nil
+}
+
+// FormatLine formats a measurement in the listen poller's shh format. mtype
+// is "g" or "c" and value is a uint64 or float64.
+func FormatLine(when time.Time, name string, value interface{}, mtype, unit string) string {
+	var vs string
+	switch v := value.(type) {
+	case uint64:
+		vs = strconv.FormatUint(v, 10)
+	case float64:
+		// Always written with a decimal point, so it's parsed as a float
+		vs = strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.ContainsAny(vs, ".") {
+			vs += ".0"
+		}
+	default:
+		vs = fmt.Sprint(v)
+	}
+
+	ts := when.Format(time.RFC3339)
+	if unit == "" {
+		return fmt.Sprintf("%s %s %s %s\n", ts, name, vs, mtype)
+	}
+	return fmt.Sprintf("%s %s %s %s %s\n", ts, name, vs, mtype, unit)
+}
+
+// ParseAddr splits a <net>,<addr> address, as used by SHH_ADDRESS. An
+// address without a network is tcp.
+func ParseAddr(addr string) (network, address string, err error) {
+	bits := strings.SplitN(addr, ",", 2)
+	if len(bits) == 1 {
+		network, address = "tcp", bits[0]
+	} else {
+		network, address = bits[0], bits[1]
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix", "udp", "udp4", "udp6", "unixgram":
+	default:
+		return "", "", fmt.Errorf("unsupported network %q in %q", network, addr)
+	}
+	if address == "" {
+		return "", "", fmt.Errorf("missing address in %q", addr)
+	}
+	return network, address, nil
+}
+
+// Client buffers measurements and writes them to shh in the background
+type Client struct {
+	network, address string
+	datagram         bool
+
+	// ReconnectDelay and CloseTimeout may be changed before the first
+	// measurement is sent.
+	ReconnectDelay time.Duration
+	CloseTimeout   time.Duration
+
+	lines   chan string
+	dropped uint64
+	sent    uint64
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+	abort  chan struct{}
+	start  sync.Once
+}
+
+// New returns a client for the shh listening on addr, buffering up to
+// bufferSize measurements (DEFAULT_BUFFER_SIZE if <= 0). It doesn't connect
+// until the first measurement is sent, so shh needn't be running yet.
+func New(addr string, bufferSize int) (*Client, error) {
+	network, address, err := ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if bufferSize <= 0 {
+		bufferSize = DEFAULT_BUFFER_SIZE
+	}
+
+	return &Client{
+		network:        network,
+		address:        address,
+		datagram:       network == "udp" || network == "udp4" || network == "udp6" || network == "unixgram",
+		ReconnectDelay: DEFAULT_RECONNECT_DELAY,
+		CloseTimeout:   DEFAULT_CLOSE_TIMEOUT,
+		lines:          make(chan string, bufferSize),
+		done:           make(chan struct{}),
+		abort:          make(chan struct{}),
+	}, nil
+}
+
+// Gauge records the current value of name
+func (c *Client) Gauge(name string, value float64, unit string) error {
+	return c.send(name, value, "g", unit)
+}
+
+// Counter records a monotonically increasing count for name
+func (c *Client) Counter(name string, value uint64, unit string) error {
+	return c.send(name, value, "c", unit)
+}
+
+// Timing records d, in seconds, as a gauge for name
+func (c *Client) Timing(name string, d time.Duration) error {
+	return c.send(name, d.Seconds(), "g", "Seconds,s")
+}
+
+// Dropped returns how many measurements have been dropped because the
+// buffer was full, or couldn't be flushed on Close.
+func (c *Client) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Sent returns how many measurements have been written to shh
+func (c *Client) Sent() uint64 {
+	return atomic.LoadUint64(&c.sent)
+}
+
+func (c *Client) send(name string, value interface{}, mtype, unit string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if err := ValidateUnit(unit); err != nil {
+		return err
+	}
+
+	line := FormatLine(time.Now(), name, value, mtype, unit)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	c.start.Do(func() { go c.run() })
+
+	select {
+	case c.lines <- line:
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+	}
+	return nil
+}
+
+// Close flushes buffered measurements, waiting up to CloseTimeout for shh,
+// and stops the client. Measurements that can't be flushed are dropped.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	close(c.lines)
+	c.mu.Unlock()
+
+	// Nothing was ever sent, so there's nothing running to flush
+	c.start.Do(func() { close(c.done) })
+
+	select {
+	case <-c.done:
+	case <-time.After(c.CloseTimeout):
+		close(c.abort)
+		<-c.done
+	}
+	return nil
+}
+
+// run writes buffered lines to shh until the client is closed and the
+// buffer is drained, or Close gives up on it.
+func (c *Client) run() {
+	defer close(c.done)
+
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	delay := c.ReconnectDelay
+	for line := range c.lines {
+		batch := c.batch(line)
+
+		for {
+			if conn == nil {
+				var err error
+				if conn, err = net.DialTimeout(c.network, c.address, WRITE_TIMEOUT); err != nil {
+					conn = nil
+					if !c.wait(delay) {
+						c.dropRemaining(len(batch))
+						return
+					}
+					if delay *= 2; delay > MAX_RECONNECT_DELAY {
+						delay = MAX_RECONNECT_DELAY
+					}
+					continue
+				}
+				delay = c.ReconnectDelay
+			}
+
+			// A batch that fails part way through is resent in full on the
+			// next connection, so shh may see some of it twice.
+			if err := c.write(conn, batch); err != nil {
+				conn.Close()
+				conn = nil
+				continue
+			}
+			atomic.AddUint64(&c.sent, uint64(len(batch)))
+			break
+		}
+	}
+}
+
+// batch returns line along with any others already buffered, up to
+// MAX_BATCH_SIZE lines.
+func (c *Client) batch(line string) []string {
+	batch := []string{line}
+	for len(batch) < MAX_BATCH_SIZE {
+		select {
+		case line, ok := <-c.lines:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, line)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// write sends batch to conn in a single write for stream connections, or a
+// line per packet for datagram connections.
+func (c *Client) write(conn net.Conn, batch []string) error {
+	conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+
+	if !c.datagram {
+		_, err := io.WriteString(conn, strings.Join(batch, ""))
+		return err
+	}
+
+	for _, line := range batch {
+		if _, err := io.WriteString(conn, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait sleeps for d, returning false if Close gave up in the meantime
+func (c *Client) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-c.abort:
+		return false
+	}
+}
+
+// dropRemaining counts n unsent lines and everything still buffered as
+// dropped
+func (c *Client) dropRemaining(n int) {
+	atomic.AddUint64(&c.dropped, uint64(n))
+	for range c.lines {
+		atomic.AddUint64(&c.dropped, 1)
+	}
+}
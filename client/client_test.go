@@ -0,0 +1,214 @@
+package client
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector accepts connections on a unix socket, recording every line
+type collector struct {
+	sync.Mutex
+	listener net.Listener
+	lines    []string
+}
+
+func newCollector(t *testing.T, path string) *collector {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &collector{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					c.Lock()
+					c.lines = append(c.lines, scanner.Text())
+					c.Unlock()
+				}
+			}()
+		}
+	}()
+	return c
+}
+
+func (c *collector) waitFor(n int) []string {
+	for i := 0; i < 200; i++ {
+		c.Lock()
+		if len(c.lines) >= n {
+			lines := append([]string(nil), c.lines...)
+			c.Unlock()
+			return lines
+		}
+		c.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.lines...)
+}
+
+func tempSocket(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "shh-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "shh.sock"), func() { os.RemoveAll(dir) }
+}
+
+func TestFormatLine(t *testing.T) {
+	when := time.Date(2014, 1, 29, 1, 1, 1, 0, time.UTC)
+
+	cases := []struct {
+		value    interface{}
+		mtype    string
+		unit     string
+		expected string
+	}{
+		{uint64(10), "c", "", "2014-01-29T01:01:01Z a.b 10 c\n"},
+		{float64(10), "g", "", "2014-01-29T01:01:01Z a.b 10.0 g\n"},
+		{1.5, "g", "Bytes,b", "2014-01-29T01:01:01Z a.b 1.5 g Bytes,b\n"},
+	}
+
+	for _, c := range cases {
+		if line := FormatLine(when, "a.b", c.value, c.mtype, c.unit); line != c.expected {
+			t.Errorf("Should have formatted %v as %q, got %q", c.value, c.expected, line)
+		}
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	network, address, err := ParseAddr("unix,#shh")
+	if err != nil || network != "unix" || address != "#shh" {
+		t.Errorf("Should have parsed unix,#shh, got %q %q %v", network, address, err)
+	}
+
+	network, address, err = ParseAddr("127.0.0.1:8000")
+	if err != nil || network != "tcp" || address != "127.0.0.1:8000" {
+		t.Errorf("Should have defaulted to tcp, got %q %q %v", network, address, err)
+	}
+
+	failure_cases := []string{"http,127.0.0.1:8000", "unix,", ""}
+	for _, addr := range failure_cases {
+		if _, _, err := ParseAddr(addr); err == nil {
+			t.Errorf("Should have failed to parse %q", addr)
+		}
+	}
+}
+
+func TestClient_Validation(t *testing.T) {
+	c, err := New("unix,/nonexistent/shh.sock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Gauge("bad name", 1, ""); err == nil {
+		t.Errorf("Should have rejected an improper metric name")
+	}
+	if err := c.Counter("a.b", 1, "Bytes b"); err == nil {
+		t.Errorf("Should have rejected an improper unit")
+	}
+
+	c.Close()
+	if err := c.Gauge("a.b", 1, ""); err != ErrClosed {
+		t.Errorf("Should have returned ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestClient_SendAndClose(t *testing.T) {
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+
+	collector := newCollector(t, path)
+	defer collector.listener.Close()
+
+	c, err := New("unix,"+path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Gauge("queue.depth", 12, "")
+	c.Counter("requests", 100, "Requests,req")
+	c.Timing("backup.duration", 1500*time.Millisecond)
+	c.Close()
+
+	lines := collector.waitFor(3)
+	if len(lines) != 3 {
+		t.Fatalf("Should have received 3 lines, got %d: %v", len(lines), lines)
+	}
+
+	expected := []string{" queue.depth 12.0 g", " requests 100 c Requests,req", " backup.duration 1.5 g Seconds,s"}
+	for i, suffix := range expected {
+		if !strings.HasSuffix(lines[i], suffix) {
+			t.Errorf("Should have received a line ending %q, got %q", suffix, lines[i])
+		}
+	}
+
+	if c.Sent() != 3 || c.Dropped() != 0 {
+		t.Errorf("Should have sent 3 and dropped 0, got %d and %d", c.Sent(), c.Dropped())
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+
+	c, err := New("unix,"+path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ReconnectDelay = 10 * time.Millisecond
+
+	// Nothing is listening yet, so this is buffered until it is
+	c.Gauge("early", 1, "")
+	time.Sleep(30 * time.Millisecond)
+
+	collector := newCollector(t, path)
+	defer collector.listener.Close()
+
+	c.Gauge("late", 2, "")
+	c.Close()
+
+	if lines := collector.waitFor(2); len(lines) != 2 {
+		t.Errorf("Should have received 2 lines after reconnecting, got %d: %v", len(lines), lines)
+	}
+}
+
+func TestClient_DropsWhenFull(t *testing.T) {
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+
+	c, err := New("unix,"+path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ReconnectDelay = time.Hour
+	c.CloseTimeout = 10 * time.Millisecond
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		c.Gauge("a.b", float64(i), "")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Should not have blocked while shh is unreachable")
+	}
+
+	c.Close()
+	if c.Dropped() != 10 {
+		t.Errorf("Should have dropped all 10 measurements, got %d", c.Dropped())
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -18,8 +20,7 @@ var (
 	measurementType = flag.String("t", "g", "Measurement type gauge(g) or counter(c)")
 	shhAddr         = flag.String("a", shh.DEFAULT_LISTEN_ADDR, "Address of a listening shh (protocol,addr)")
 	unitFlag        = flag.String("u", "", "Unit of measurement and an optional abbreviation (ex. Bytes,b)")
-
-	unitRegexp = regexp.MustCompile("[a-zA-Z$%#]+(,[a-zA-Z$%#]+)?")
+	fileFlag        = flag.String("f", "", "Read '<metric-name> <value> [type] [unit]' lines from this file (- for stdin) and send them over one connection")
 )
 
 func getConnection(addr string) (net.Conn, error) {
@@ -38,43 +39,72 @@ func die(msg string) {
 	os.Exit(1)
 }
 
-func assertValidMetricName(mn string) string {
+func validMetricName(mn string) error {
 	if !shh.MetricNameRegexp.MatchString(mn) {
-		die("ERROR: invalid metric name\n")
+		return errors.New("invalid metric name")
 	}
-
-	return mn
+	return nil
 }
 
-func assertValidUnit(unit string) string {
-	if unit != "" && !unitRegexp.MatchString(unit) {
-		die("ERROR: invalid unit\n")
+func validUnit(unit string) error {
+	if unit != "" && !shh.UnitRegexp.MatchString(unit) {
+		return errors.New("invalid unit")
 	}
-
-	return unit
+	return nil
 }
 
-func assertValidType(t string) string {
+func validType(t string) (string, error) {
 	if t == "gauge" || t == "g" {
-		return "g"
+		return "g", nil
 	}
 	if t == "counter" || t == "c" {
-		return "c"
+		return "c", nil
 	}
-	die("ERROR: invalid measurement type\n")
-	return ""
+	return "", errors.New("invalid measurement type")
 }
 
-func assertValidValue(v string) interface{} {
+func validValue(v string) (interface{}, error) {
 	vint, err := strconv.ParseUint(v, 10, 64)
 	if err != nil {
 		vflo, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			die("ERROR: invalid value\n")
+			return nil, errors.New("invalid value")
 		}
-		return vflo
+		return vflo, nil
+	}
+	return vint, nil
+}
+
+func assertValidMetricName(mn string) string {
+	if err := validMetricName(mn); err != nil {
+		die("ERROR: " + err.Error() + "\n")
+	}
+
+	return mn
+}
+
+func assertValidUnit(unit string) string {
+	if err := validUnit(unit); err != nil {
+		die("ERROR: " + err.Error() + "\n")
 	}
-	return vint
+
+	return unit
+}
+
+func assertValidType(t string) string {
+	mt, err := validType(t)
+	if err != nil {
+		die("ERROR: " + err.Error() + "\n")
+	}
+	return mt
+}
+
+func assertValidValue(v string) interface{} {
+	value, err := validValue(v)
+	if err != nil {
+		die("ERROR: " + err.Error() + "\n")
+	}
+	return value
 }
 
 func formatLine(metric string, value interface{}, mtype string, unit string) string {
@@ -85,9 +115,108 @@ func formatLine(metric string, value interface{}, mtype string, unit string) str
 	return fmt.Sprintf("%s %s %v %s %s\n", ts, metric, value, mtype, unit)
 }
 
+// parseBatchLine validates a '<metric-name> <value> [type] [unit]' line and
+// formats it for shh. The type and unit default to those given by -t and -u.
+func parseBatchLine(line, defType, defUnit string) (string, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 4 {
+		return "", fmt.Errorf("expected 2, 3 or 4 fields, found %d", len(fields))
+	}
+
+	if err := validMetricName(fields[0]); err != nil {
+		return "", err
+	}
+
+	value, err := validValue(fields[1])
+	if err != nil {
+		return "", err
+	}
+
+	t := defType
+	if len(fields) >= 3 {
+		t = fields[2]
+	}
+	mtype, err := validType(t)
+	if err != nil {
+		return "", err
+	}
+
+	unit := defUnit
+	if len(fields) == 4 {
+		unit = fields[3]
+	}
+	if err := validUnit(unit); err != nil {
+		return "", err
+	}
+
+	return formatLine(fields[0], value, mtype, unit), nil
+}
+
+// sendBatch sends every valid line read from in over conn, reporting invalid
+// lines on stderr. It returns the number of lines that failed.
+func sendBatch(in io.Reader, conn net.Conn, defType, defUnit string) (int, error) {
+	failed := 0
+	scanner := bufio.NewScanner(in)
+
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		line, err := parseBatchLine(text, defType, defUnit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: line %d: %s: %q\n", n, err, text)
+			failed++
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(time.Second * 5))
+		if _, err := io.WriteString(conn, line); err != nil {
+			return failed, err
+		}
+		fmt.Print(line)
+	}
+
+	return failed, scanner.Err()
+}
+
+func batch(file, addr string) {
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			die(fmt.Sprintf("ERROR: couldn't open %s: %s\n", file, err))
+		}
+		defer f.Close()
+		in = f
+	}
+
+	mmType := assertValidType(*measurementType)
+	unit := assertValidUnit(*unitFlag)
+
+	conn, err := getConnection(addr)
+	if err != nil {
+		die(fmt.Sprintf("ERROR: couldn't get connection to %s: %s\n", addr, err))
+	}
+	defer conn.Close()
+
+	failed, err := sendBatch(in, conn, mmType, unit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: %d line(s) failed\n", failed)
+		os.Exit(1)
+	}
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "usage: %s [options] <metric-name> <value>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options] -f <file|->\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options] run -n <metric-name> -- <cmd> [args...]\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
@@ -98,6 +227,21 @@ func main() {
 		os.Exit(0)
 	}
 
+	addr := shh.GetEnvWithDefault("SHH_ADDRESS", *shhAddr)
+
+	if isRun(flag.Args()) {
+		runCommand(flag.Args()[1:], addr)
+		return
+	}
+
+	if *fileFlag != "" {
+		if flag.NArg() != 0 {
+			die("")
+		}
+		batch(*fileFlag, addr)
+		return
+	}
+
 	if flag.NArg() != 2 {
 		die("")
 	}
@@ -111,13 +255,13 @@ func main() {
 		die("ERROR: invalid metric name\n")
 	}
 
-	conn, err := getConnection(shh.GetEnvWithDefault("SHH_ADDRESS", *shhAddr))
+	conn, err := getConnection(addr)
 	if err != nil {
 		die(fmt.Sprintf("ERROR: couldn't get connection to %s: %s\n", *shhAddr, err))
 	}
 	conn.SetDeadline(time.Now().Add(time.Second * 5))
 	line := formatLine(metric, value, mmType, unit)
-	fmt.Printf(line)
-	fmt.Fprintf(conn, line)
+	fmt.Print(line)
+	fmt.Fprint(conn, line)
 	conn.Close()
 }
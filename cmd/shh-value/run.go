@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/heroku/shh"
+)
+
+// isRun reports whether args invoke the command wrapper, i.e. look like
+// 'run [options] -- <cmd...>'. Anything else, such as a metric named run,
+// is sent as a single measurement.
+func isRun(args []string) bool {
+	if len(args) < 2 || args[0] != "run" {
+		return false
+	}
+	for _, arg := range args[1:] {
+		if arg == "--" {
+			return true
+		}
+	}
+	return false
+}
+
+// runCommand runs the command in args, passing stdio through, and reports
+// its wall time, CPU time, max RSS and exit code as <name>.* measurements.
+// It exits with the command's status.
+func runCommand(args []string, addr string) {
+	runFlags := flag.NewFlagSet("run", flag.ExitOnError)
+	name := runFlags.String("n", "", "Prefix for the reported metric names (ex. backup.nightly)")
+	runFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] run -n <metric-name> -- <cmd> [args...]\n", os.Args[0])
+		runFlags.PrintDefaults()
+	}
+	runFlags.Parse(args)
+
+	if *name == "" || runFlags.NArg() == 0 {
+		runFlags.Usage()
+		os.Exit(1)
+	}
+	if err := validMetricName(*name); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		runFlags.Usage()
+		os.Exit(1)
+	}
+
+	cmd := exec.Command(runFlags.Arg(0), runFlags.Args()[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Signals meant for the command are passed on, rather than killing us
+	// before we've reported it.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	start := time.Now()
+	code := 0
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: couldn't run %s: %s\n", runFlags.Arg(0), err)
+		code = 127
+	} else {
+		go func() {
+			for sig := range signals {
+				cmd.Process.Signal(sig)
+			}
+		}()
+		cmd.Wait()
+		code = exitCode(cmd.ProcessState)
+	}
+	wall := time.Since(start)
+
+	lines := runLines(*name, code, wall, cmd.ProcessState)
+
+	// The command's status matters more than the report, so failing to send
+	// it is only noted.
+	if err := sendLines(addr, lines); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: couldn't report to %s: %s\n", addr, err)
+	}
+
+	os.Exit(code)
+}
+
+// runLines formats the measurements reported for a command run as name,
+// which took wall and exited with code. ps is nil if it never started.
+func runLines(name string, code int, wall time.Duration, ps *os.ProcessState) []string {
+	lines := []string{
+		formatLine(name+".wall", seconds(wall), "g", shh.Seconds.Name()+","+shh.Seconds.Abbr()),
+		formatLine(name+".exit-code", code, "g", ""),
+	}
+	if ps != nil {
+		lines = append(lines,
+			formatLine(name+".cpu.user", seconds(ps.UserTime()), "g", shh.Seconds.Name()+","+shh.Seconds.Abbr()),
+			formatLine(name+".cpu.sys", seconds(ps.SystemTime()), "g", shh.Seconds.Name()+","+shh.Seconds.Abbr()),
+		)
+		if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+			// ru_maxrss is in kilobytes on linux
+			lines = append(lines, formatLine(name+".maxrss", uint64(ru.Maxrss)*1024, "g", shh.Bytes.Name()+","+shh.Bytes.Abbr()))
+		}
+	}
+	return lines
+}
+
+// exitCode returns the status a shell would report for the command: its exit
+// status, or 128 plus the signal that killed it.
+func exitCode(ps *os.ProcessState) int {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ps.ExitCode()
+}
+
+// seconds formats d so that it's always parsed as a float, even when whole
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 6, 64)
+}
+
+func sendLines(addr string, lines []string) error {
+	conn, err := getConnection(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+	for _, line := range lines {
+		if _, err := io.WriteString(conn, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
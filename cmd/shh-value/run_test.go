@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heroku/shh/client"
+)
+
+func TestRunLines_MetricNames(t *testing.T) {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("Couldn't run true: %s", err)
+	}
+
+	lines := runLines("backup.nightly", exitCode(cmd.ProcessState), time.Second, cmd.ProcessState)
+	if len(lines) != 5 {
+		t.Errorf("Should have 5 lines, got %d: %q", len(lines), lines)
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			t.Errorf("Should have at least 4 fields in %q", line)
+			continue
+		}
+		if !client.MetricNameRegexp.MatchString(fields[1]) {
+			t.Errorf("Should have a valid metric name, got %q", fields[1])
+		}
+	}
+}
+
+func TestRunLines_NotStarted(t *testing.T) {
+	lines := runLines("backup.nightly", 127, 0, nil)
+	if len(lines) != 2 {
+		t.Errorf("Should have 2 lines, got %d: %q", len(lines), lines)
+	}
+	if !strings.Contains(lines[1], " backup.nightly.exit-code 127 g") {
+		t.Errorf("Should report the exit code as backup.nightly.exit-code, got %q", lines[1])
+	}
+}
@@ -7,7 +7,9 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/heroku/shh"
@@ -17,6 +19,14 @@ import (
 var (
 	signalChannel = make(chan os.Signal, 1)
 	versionFlag   = flag.Bool("version", false, "Display version info and exit")
+	checkConfig   = flag.Bool("check-config", false, "Validate the configuration, print it with secrets redacted and exit")
+	listMetrics   = flag.Bool("list-metrics", false, "List the metrics each poller can report and exit")
+	replayFile    = flag.String("replay", "", "Send the measurements recorded in this file (see SHH_RECORD) to the outputter and exit")
+	replayFast    = flag.Bool("replay-fast", false, "Replay as fast as possible, rather than in real time")
+	replayDrain   = flag.Duration("replay-drain", 0, "Time to wait for the outputter to deliver after replaying, defaults to twice SHH_LIBRATO_BATCH_TIMEOUT for librato and 1s otherwise")
+	onceFlag      = flag.Bool("once", false, "Poll twice, print the second poll's measurements and exit")
+	onceDelay     = flag.Duration("once-delay", shh.DEFAULT_ONCE_DELAY, "Delay between the two polls made by -once")
+	onceFormat    = flag.String("once-format", shh.DEFAULT_ONCE_FORMAT, "Format -once prints in: "+strings.Join(shh.OnceFormats, ", "))
 )
 
 func main() {
@@ -27,11 +37,38 @@ func main() {
 		os.Exit(0)
 	}
 
-	measurements := make(chan shh.Measurement, 100)
+	if *listMetrics {
+		list()
+	}
+
+	if *checkConfig {
+		check()
+	}
+
 	config := shh.GetConfig()
 
+	if *onceFlag {
+		once(config)
+	}
+
+	if *replayFile != "" {
+		replay(config)
+	}
+
+	measurements := make(chan shh.Measurement, 100)
+
 	mp := shh.NewMultiPoller(measurements, config)
 
+	var recorder *shh.Recorder
+	var outgoing <-chan shh.Measurement = measurements
+	if config.Record != "" {
+		var err error
+		if recorder, err = shh.NewRecorder(config.Record); err != nil {
+			shh.FatalError(slog.Context{"fn": "main", "file": config.Record}, err, "creating recording")
+		}
+		outgoing = recorder.Tee(measurements)
+	}
+
 	signal.Notify(signalChannel, syscall.SIGINT)
 	signal.Notify(signalChannel, syscall.SIGTERM)
 
@@ -39,7 +76,11 @@ func main() {
 		for sig := range signalChannel {
 			now := time.Now()
 			shh.ErrLogger.Println(slog.Context{"signal": sig, "finishing": now, "runtime": time.Since(config.Start)})
+			shh.SdNotify("STOPPING=1")
 			mp.Exit()
+			if err := recorder.Close(); err != nil {
+				shh.LogError(slog.Context{"fn": "main"}, err, "closing recording")
+			}
 			shh.ErrLogger.Fatalln(slog.Context{"signal": sig, "finished": time.Now(), "duration": time.Since(now)})
 		}
 	}()
@@ -53,7 +94,7 @@ func main() {
 	ctx := slog.Context{"start": true, "interval": config.Interval}
 	shh.Logger.Println(ctx)
 
-	outputter, err := shh.NewOutputter(config.Outputter, measurements, config)
+	outputter, err := shh.NewOutputter(config.Outputter, outgoing, config)
 	if err != nil {
 		shh.FatalError(ctx, err, "creating outputter")
 	}
@@ -62,14 +103,135 @@ func main() {
 	start := make(chan time.Time, 1)
 	start <- time.Now()
 	ticks := time.Tick(config.Interval)
+	watchdog := false
 
 	for {
 		select {
 		case tick := <-start:
 			mp.Poll(tick)
 			start = nil
+			watchdog = notifyReady(ctx, config.Interval)
 		case tick := <-ticks:
 			mp.Poll(tick)
+			shh.SdNotify("STATUS=last polled at " + tick.Format(time.RFC3339))
+		}
+
+		// Only pinging once a poll has completed means a hung poller, or an
+		// outputter that stops draining measurements, trips the watchdog.
+		if watchdog {
+			if err := shh.SdNotify("WATCHDOG=1"); err != nil {
+				shh.LogError(ctx, err, "pinging systemd watchdog")
+			}
+		}
+	}
+}
+
+// notifyReady tells systemd that shh is up, once the outputter has started
+// and the first poll has completed. It reports whether the watchdog is
+// enabled, to be pinged after every poll, warning if it would expire
+// between them.
+func notifyReady(ctx slog.Context, pollInterval time.Duration) bool {
+	if err := shh.SdNotify("READY=1\nSTATUS=first poll complete"); err != nil {
+		shh.LogError(ctx, err, "notifying systemd")
+	}
+
+	interval, err := shh.SdWatchdogInterval()
+	if err != nil {
+		shh.LogError(ctx, err, "reading watchdog interval")
+	}
+
+	// SdWatchdogInterval is half of WatchdogSec=
+	if interval > 0 && 2*interval <= pollInterval {
+		shh.LogError(ctx, fmt.Errorf("WatchdogSec=%s isn't longer than SHH_INTERVAL=%s", 2*interval, pollInterval), "checking watchdog interval")
+	}
+
+	return interval > 0
+}
+
+// once prints the measurements from a single collection, exiting non-zero if
+// any poller reported an error.
+func once(config shh.Config) {
+	if !shh.SliceContainsString(shh.OnceFormats, *onceFormat) {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected one of %s\n", *onceFormat, strings.Join(shh.OnceFormats, ", "))
+		os.Exit(2)
+	}
+
+	mms, failed := shh.CollectOnce(config, *onceDelay)
+	if err := shh.WriteMeasurements(os.Stdout, mms, *onceFormat, config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "pollers reported errors: %s\n", strings.Join(failed, ", "))
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// check prints the effective configuration and every problem with it,
+// exiting non-zero if there are any.
+func check() {
+	config, settings, errs := shh.LoadConfig()
+	errs = append(errs, shh.CheckConfig(config)...)
+
+	for _, setting := range settings {
+		fmt.Printf("%s=%s\n", setting.Env, setting.Value)
+	}
+
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d problem(s) found:\n", len(errs))
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "  %s\n", err)
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// list prints the descriptor of every metric the pollers can report
+func list() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tUNIT\tENABLED BY\tDESCRIPTION")
+	for _, mds := range append(shh.SortedPollerMetrics(), shh.MultiMetrics) {
+		for _, md := range mds {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", md.Name, md.Type, md.Unit.Name(), md.EnabledBy, md.Description)
 		}
 	}
+	w.Flush()
+	os.Exit(0)
+}
+
+// replay sends a recording to the outputter, waiting for it to deliver
+// before exiting.
+func replay(config shh.Config) {
+	ctx := slog.Context{"fn": "replay", "file": *replayFile}
+
+	measurements := make(chan shh.Measurement, 100)
+	outputter, err := shh.NewOutputter(config.Outputter, measurements, config)
+	if err != nil {
+		shh.FatalError(ctx, err, "creating outputter")
+	}
+	outputter.Start()
+
+	count, err := shh.Replay(*replayFile, measurements, !*replayFast)
+	ctx["count"] = count
+	if err != nil {
+		shh.FatalError(ctx, err, "replaying")
+	}
+
+	drain := *replayDrain
+	if drain == 0 {
+		drain = time.Second
+		if config.Outputter == "librato" {
+			drain = 2 * config.LibratoBatchTimeout
+		}
+	}
+	for len(measurements) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(drain)
+
+	shh.Logger.Println(ctx)
+	os.Exit(0)
 }
@@ -0,0 +1,197 @@
+package shh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// CheckConfig validates config for the selected pollers and outputter,
+// returning every problem found rather than stopping at the first. Settings
+// that only matter to pollers or outputters that aren't selected are not
+// checked.
+func CheckConfig(config Config) []error {
+	errs := make([]error, 0)
+	problem := func(env, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", env, fmt.Sprintf(format, args...)))
+	}
+
+	if config.Interval <= 0 {
+		problem("SHH_INTERVAL", "must be greater than 0")
+	}
+	if _, err := strconv.ParseUint(config.ProfilePort, 10, 16); err != nil {
+		problem("SHH_PROFILE_PORT", "%q is not a port", config.ProfilePort)
+	}
+	if config.Ticks <= 0 {
+		problem("SHH_TICKS", "must be greater than 0")
+	}
+	if config.PageSize <= 0 {
+		problem("SHH_PAGE_SIZE", "must be greater than 0")
+	}
+
+	for _, root := range []struct {
+		env, path string
+	}{
+		{"SHH_PROC_ROOT", config.ProcRoot},
+		{"SHH_SYS_ROOT", config.SysRoot},
+		{"SHH_HOST_ROOT", config.HostRoot},
+	} {
+		if fi, err := os.Stat(root.path); err != nil {
+			problem(root.env, "%s", err)
+		} else if !fi.IsDir() {
+			problem(root.env, "%s is not a directory", root.path)
+		}
+	}
+
+	for _, env := range []struct {
+		name    string
+		pollers []string
+	}{
+		{"SHH_POLLERS", config.Pollers},
+		{"SHH_PERCENTAGES", config.Percentages},
+		{"SHH_FULL", config.Full},
+	} {
+		for _, poller := range env.pollers {
+			if !SliceContainsString(KnownPollers, poller) {
+				problem(env.name, "unknown poller %q", poller)
+			}
+		}
+	}
+
+	for _, poller := range config.Pollers {
+		switch poller {
+		case "listen":
+			if _, err := parseListenAddrs(config.Listen); err != nil {
+				problem("SHH_LISTEN", "%s", err)
+			}
+			switch config.ListenInfluxTags {
+			case "", INFLUX_TAGS_KEEP, INFLUX_TAGS_FLATTEN:
+			default:
+				problem("SHH_LISTEN_INFLUX_TAGS", "%q should be one of: %s, %s", config.ListenInfluxTags, INFLUX_TAGS_KEEP, INFLUX_TAGS_FLATTEN)
+			}
+			if _, err := newSocketPerms(config.ListenSocketMode, config.ListenSocketOwner, config.ListenSocketGroup); err != nil {
+				problem("SHH_LISTEN_SOCKET_MODE/OWNER/GROUP", "%s", err)
+			}
+			if config.ListenTimeout <= 0 {
+				problem("SHH_LISTEN_TIMEOUT", "must be greater than 0")
+			}
+			if config.ListenMaxConnections < 0 {
+				problem("SHH_LISTEN_MAX_CONNECTIONS", "must not be negative")
+			}
+			if config.ListenRateLimit < 0 {
+				problem("SHH_LISTEN_RATE_LIMIT", "must not be negative")
+			}
+			if config.ListenMaxNames < 0 {
+				problem("SHH_LISTEN_MAX_NAMES", "must not be negative")
+			}
+		case "redis":
+			if _, err := parseRedisInfo(config.RedisInfo); err != nil {
+				problem("SHH_REDIS_INFO", "%s", err)
+			}
+			if config.RedisUrl == nil {
+				problem("SHH_REDIS_URL", "is required by the redis poller")
+			}
+		case "splunksearchpeers":
+			if config.SplunkPeersUrl == nil {
+				problem("SHH_SPLUNK_PEERS_URL", "is required by the splunksearchpeers poller")
+			}
+		case "folsom":
+			if config.FolsomBaseUrl == nil {
+				problem("SHH_FOLSOM_BASE_URL", "is required by the folsom poller")
+			}
+		case "ntpdate":
+			if len(config.NtpdateServers) == 0 {
+				problem("SHH_NTPDATE_SERVERS", "is required by the ntpdate poller")
+			}
+		case "nif":
+			if len(config.NifDevices) == 0 && !config.NifDiscover {
+				problem("SHH_NIF_DEVICES", "is required by the nif poller, unless SHH_NIF_DISCOVER is set")
+			}
+			for _, device := range config.NifDevices {
+				if err := checkPattern(device); err != nil {
+					problem("SHH_NIF_DEVICES", "%s", err)
+				}
+			}
+		case "pressure":
+			if config.PressureCgroups && len(config.Cgroups) == 0 {
+				problem("SHH_CGROUPS", "is required by SHH_PRESSURE_CGROUPS")
+			}
+			// the patterns are checked with the cgroup poller, if it's selected
+			if config.PressureCgroups && !SliceContainsString(config.Pollers, "cgroup") {
+				for _, cgroup := range config.Cgroups {
+					if err := checkPattern(cgroup); err != nil {
+						problem("SHH_CGROUPS", "%s", err)
+					}
+				}
+			}
+		case "containers":
+			if config.ContainersSocket == "" {
+				problem("SHH_CONTAINERS_SOCKET", "is required by the containers poller")
+			}
+		case "tcp":
+			for _, port := range config.TcpPorts {
+				if _, err := parseTcpPort(port); err != nil {
+					problem("SHH_TCP_PORTS", "%q is not a port", port)
+				}
+			}
+		case "cgroup":
+			if len(config.Cgroups) == 0 {
+				problem("SHH_CGROUPS", "is required by the cgroup poller")
+			}
+			for _, cgroup := range config.Cgroups {
+				if err := checkPattern(cgroup); err != nil {
+					problem("SHH_CGROUPS", "%s", err)
+				}
+			}
+			if config.CgroupReadOnly && (config.CgroupSampleInterval <= 0 || config.CgroupSampleInterval > config.Interval) {
+				problem("SHH_CGROUP_SAMPLE_INTERVAL", "must be greater than 0 and no more than SHH_INTERVAL")
+			}
+		}
+	}
+
+	switch config.Outputter {
+	case "librato":
+		user, token := config.LibratoUser, config.LibratoToken
+		if config.LibratoUrl != nil && config.LibratoUrl.User != nil {
+			if user == "" {
+				user = config.LibratoUrl.User.Username()
+			}
+			if token == "" {
+				token, _ = config.LibratoUrl.User.Password()
+			}
+		}
+		if user == "" || token == "" {
+			problem("SHH_LIBRATO_USER/TOKEN", "are required by the librato outputter, directly or in SHH_LIBRATO_URL")
+		}
+		if config.LibratoBatchSize <= 0 {
+			problem("SHH_LIBRATO_BATCH_SIZE", "must be greater than 0")
+		}
+		if config.LibratoBatchTimeout <= 0 {
+			problem("SHH_LIBRATO_BATCH_TIMEOUT", "must be greater than 0")
+		}
+	case "carbon":
+		if config.CarbonHost == "" {
+			problem("SHH_CARBON_HOST", "is required by the carbon outputter")
+		} else if _, _, err := net.SplitHostPort(config.CarbonHost); err != nil {
+			problem("SHH_CARBON_HOST", "%s", err)
+		}
+	case "statsd":
+		if config.StatsdHost == "" {
+			problem("SHH_STATSD_HOST", "is required by the statsd outputter")
+		} else if _, _, err := net.SplitHostPort(config.StatsdHost); err != nil {
+			problem("SHH_STATSD_HOST", "%s", err)
+		}
+		switch config.StatsdProto {
+		case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+		default:
+			problem("SHH_STATSD_PROTO", "%q should be udp or tcp", config.StatsdProto)
+		}
+	default:
+		if !SliceContainsString(KnownOutputters, config.Outputter) {
+			problem("SHH_OUTPUTTER", "unknown outputter %q", config.Outputter)
+		}
+	}
+
+	return errs
+}
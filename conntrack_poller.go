@@ -2,7 +2,10 @@ package shh
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/heroku/slog"
@@ -10,26 +13,58 @@ import (
 
 const (
 	CONNTRACK_DATA = "/proc/sys/net/netfilter/nf_conntrack_count"
+	CONNTRACK_STAT = "/proc/net/stat/nf_conntrack" // per cpu statistics, each line starting with the count in hex
 )
 
+var conntrackMetrics = []MetricDescriptor{
+	{"conntrack.count", GaugeType, Connections, "Connections tracked by netfilter", ""},
+}
+
 type Conntrack struct {
 	measurements chan<- Measurement
+	data         string
+	stat         bool
 }
 
-func NewConntrackPoller(measurements chan<- Measurement) Conntrack {
-	return Conntrack{measurements: measurements}
+// NewConntrackPoller reads nf_conntrack_count, which is always that of our
+// own network namespace. Under another SHH_PROC_ROOT the count is read from
+// the statistics of its init's namespace instead.
+func NewConntrackPoller(measurements chan<- Measurement, config Config) Conntrack {
+	if config.otherProc() {
+		return Conntrack{measurements: measurements, data: config.procNetPath(CONNTRACK_STAT), stat: true}
+	}
+	return Conntrack{measurements: measurements, data: config.procPath(CONNTRACK_DATA)}
 }
 
 func (poller Conntrack) Poll(tick time.Time) {
 	ctx := slog.Context{"poller": poller.Name(), "fn": "Poll", "tick": tick}
 
-	count, err := ioutil.ReadFile(CONNTRACK_DATA)
+	data, err := ioutil.ReadFile(poller.data)
+	if err != nil {
+		LogError(ctx, err, "reading"+poller.data)
+		return
+	}
+
+	if !poller.stat {
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"count"}, Atouint64(string(bytes.TrimSpace(data))), Connections}
+		return
+	}
+
+	// The header line is followed by one line per cpu, all of which start
+	// with the same count.
+	lines := strings.SplitN(string(data), "\n", 3)
+	if len(lines) < 2 || len(strings.Fields(lines[1])) == 0 {
+		LogError(ctx, fmt.Errorf("no statistics"), "parsing "+poller.data)
+		return
+	}
+
+	count, err := strconv.ParseUint(strings.Fields(lines[1])[0], 16, 64)
 	if err != nil {
-		LogError(ctx, err, "reading"+CONNTRACK_DATA)
+		LogError(ctx, err, "parsing "+poller.data)
 		return
 	}
 
-	poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"count"}, Atouint64(string(bytes.TrimSpace(count))), Connections}
+	poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"count"}, count, Connections}
 }
 
 func (poller Conntrack) Name() string {
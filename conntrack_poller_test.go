@@ -0,0 +1,42 @@
+package shh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConntrackPoller(t *testing.T) {
+	root := newFixture(t, map[string]string{
+		"proc/sys/net/netfilter/nf_conntrack_count": "42\n",
+		"proc/1/net/stat/nf_conntrack": "entries  clashres found new invalid ignore delete chainlength insert insert_failed drop early_drop error\n" +
+			"000000a3  00000000 00000000 00000000 00000005 0000001c 00000000 00000000 00000000 00000000 00000000 00000000 00000000\n" +
+			"000000a3  00000000 00000000 00000000 00000002 00000009 00000000 00000000 00000000 00000000 00000000 00000000 00000000\n",
+	})
+
+	// our own network namespace, read from /proc/sys
+	poller := NewConntrackPoller(nil, Config{})
+	if poller.data != CONNTRACK_DATA || poller.stat {
+		t.Errorf("Should have read %s by default, got %+v", CONNTRACK_DATA, poller)
+	}
+
+	// the network namespace of the root's init, read from its statistics
+	values := pollValues(t, func(measurements chan<- Measurement) {
+		NewConntrackPoller(measurements, Config{ProcRoot: root + "/proc"}).Poll(time.Now())
+	})
+	if len(values) != 1 || values["conntrack.count"] != "163" {
+		t.Errorf("Should have reported conntrack.count as 163, got %v", values)
+	}
+}
+
+func TestConntrackPoller_BadStat(t *testing.T) {
+	root := newFixture(t, map[string]string{
+		"proc/1/net/stat/nf_conntrack": "entries  searched found\n",
+	})
+
+	values := pollValues(t, func(measurements chan<- Measurement) {
+		NewConntrackPoller(measurements, Config{ProcRoot: root + "/proc"}).Poll(time.Now())
+	})
+	if len(values) != 0 {
+		t.Errorf("Should not have reported anything, got %v", values)
+	}
+}
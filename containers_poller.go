@@ -0,0 +1,438 @@
+package shh
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroku/slog"
+)
+
+const (
+	CONTAINERS_API_HOST          = "docker" // the socket is dialled directly, so this is only used in the Host header
+	CONTAINERS_STATS_CONCURRENCY = 8        // stats requests made at once
+	CONTAINERS_DEPARTED_POLLS    = 10       // polls a name without containers keeps the counters of those that went away
+)
+
+// Containers are named by their name, or the value of SHH_CONTAINERS_NAME_LABEL,
+// with . replaced by - and / by --. Containers sharing a name, as replicas
+// sharing a label will, are summed, with the counters of those that have
+// gone away kept in the sums.
+var containersMetrics = []MetricDescriptor{
+	pollerErrorMetric("containers"),
+	{"containers.count", GaugeType, Containers, "Running containers", ""},
+	{"containers.<container>.count", GaugeType, Containers, "Running containers with the name", ""},
+	{"containers.<container>.cpu.usage", FloatGaugeType, Percent, "CPU used, as a percentage of one core", ""},
+	{"containers.<container>.cpu.user", FloatGaugeType, Percent, "CPU used in user mode, as a percentage of one core", ""},
+	{"containers.<container>.cpu.system", FloatGaugeType, Percent, "CPU used in kernel mode, as a percentage of one core", ""},
+	{"containers.<container>.cpu.throttled.periods", CounterType, Empty, "Enforcement periods the container was throttled in", ""},
+	{"containers.<container>.mem.usage", GaugeType, Bytes, "Memory used, less inactive page cache, as docker stats reports it", ""},
+	{"containers.<container>.mem.limit", GaugeType, Bytes, "Memory limit", ""},
+	{"containers.<container>.mem.perc", FloatGaugeType, Percent, "Memory used, as a percentage of the limit", ""},
+	{"containers.<container>.net.receive.bytes", CounterType, Bytes, "Bytes received, across all interfaces", ""},
+	{"containers.<container>.net.receive.packets", CounterType, Packets, "Packets received, across all interfaces", ""},
+	{"containers.<container>.net.receive.errors", CounterType, Errors, "Receive errors, across all interfaces", ""},
+	{"containers.<container>.net.receive.dropped", CounterType, Packets, "Received packets dropped, across all interfaces", ""},
+	{"containers.<container>.net.transmit.bytes", CounterType, Bytes, "Bytes transmitted, across all interfaces", ""},
+	{"containers.<container>.net.transmit.packets", CounterType, Packets, "Packets transmitted, across all interfaces", ""},
+	{"containers.<container>.net.transmit.errors", CounterType, Errors, "Transmit errors, across all interfaces", ""},
+	{"containers.<container>.net.transmit.dropped", CounterType, Packets, "Transmitted packets dropped, across all interfaces", ""},
+	{"containers.<container>.io.read.bytes", CounterType, Bytes, "Bytes read from block devices", ""},
+	{"containers.<container>.io.write.bytes", CounterType, Bytes, "Bytes written to block devices", ""},
+	{"containers.<container>.io.read.ops", CounterType, Ops, "Reads from block devices (cgroup v1 only)", ""},
+	{"containers.<container>.io.write.ops", CounterType, Ops, "Writes to block devices (cgroup v1 only)", ""},
+	{"containers.<container>.pids.current", GaugeType, Processes, "Processes and threads in the container", ""},
+}
+
+// dockerContainer is an entry of GET /containers/json
+type dockerContainer struct {
+	Id     string
+	Names  []string
+	Labels map[string]string
+}
+
+type dockerBlkioEntry struct {
+	Op    string `json:"op"`
+	Value uint64 `json:"value"`
+}
+
+type dockerNetworkStats struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// dockerStats is the response of GET /containers/<id>/stats, trimmed to
+// what's reported.
+type dockerStats struct {
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage        uint64 `json:"total_usage"`
+			UsageInKernelmode uint64 `json:"usage_in_kernelmode"`
+			UsageInUsermode   uint64 `json:"usage_in_usermode"`
+		} `json:"cpu_usage"`
+		ThrottlingData struct {
+			ThrottledPeriods uint64 `json:"throttled_periods"`
+		} `json:"throttling_data"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks   map[string]dockerNetworkStats `json:"networks"`
+	BlkioStats struct {
+		IoServiceBytesRecursive []dockerBlkioEntry `json:"io_service_bytes_recursive"`
+		IoServicedRecursive     []dockerBlkioEntry `json:"io_serviced_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+// memoryUsage is the memory used by the container less its inactive page
+// cache, as the docker CLI calculates it.
+func (stats dockerStats) memoryUsage() uint64 {
+	usage := stats.MemoryStats.Usage
+	inactive, ok := stats.MemoryStats.Stats["total_inactive_file"] // cgroup v1
+	if !ok {
+		inactive = stats.MemoryStats.Stats["inactive_file"] // cgroup v2
+	}
+	if inactive < usage {
+		usage -= inactive
+	}
+	return usage
+}
+
+// blkioTotal sums entries for op, which is capitalised on cgroup v1 and not
+// on v2.
+func blkioTotal(entries []dockerBlkioEntry, op string) uint64 {
+	var total uint64
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Op, op) {
+			total += entry.Value
+		}
+	}
+	return total
+}
+
+// containerCpu is a container's CPU usage, in nanoseconds, at a poll
+type containerCpu struct {
+	tick                time.Time
+	total, user, system uint64
+}
+
+// containerCounters are the counters of a container, or the sums of those
+// of the containers sharing a name
+type containerCounters struct {
+	throttledPeriods      uint64
+	net                   dockerNetworkStats
+	readBytes, writeBytes uint64
+	readOps, writeOps     uint64
+}
+
+func (c *containerCounters) add(o containerCounters) {
+	c.throttledPeriods += o.throttledPeriods
+	c.net.RxBytes += o.net.RxBytes
+	c.net.RxPackets += o.net.RxPackets
+	c.net.RxErrors += o.net.RxErrors
+	c.net.RxDropped += o.net.RxDropped
+	c.net.TxBytes += o.net.TxBytes
+	c.net.TxPackets += o.net.TxPackets
+	c.net.TxErrors += o.net.TxErrors
+	c.net.TxDropped += o.net.TxDropped
+	c.readBytes += o.readBytes
+	c.writeBytes += o.writeBytes
+	c.readOps += o.readOps
+	c.writeOps += o.writeOps
+}
+
+// containerState is what's remembered of a container between polls
+type containerState struct {
+	name     string
+	cpu      containerCpu
+	counters containerCounters
+}
+
+// containerDeparted are the summed last counters of the containers with a
+// name that went away, and when the name last had containers running
+type containerDeparted struct {
+	counters containerCounters
+	seen     time.Time
+}
+
+// containerTotals are the stats of the containers sharing a name
+type containerTotals struct {
+	count                        uint64
+	cpuUsage, cpuUser, cpuSystem float64
+	cpuSeen                      bool
+	memUsage, memLimit           uint64
+	pids                         uint64
+	counters                     containerCounters
+}
+
+type ContainersPoller struct {
+	measurements chan<- Measurement
+	client       *http.Client
+	nameLabel    string
+	containers   map[string]*containerState    // by container id
+	departed     map[string]*containerDeparted // by name
+	expiry       time.Duration                 // after which a name without containers is forgotten
+}
+
+func NewContainersPoller(measurements chan<- Measurement, config Config) ContainersPoller {
+	socket := config.ContainersSocket
+
+	client := &http.Client{
+		Timeout: config.NetworkTimeout,
+		Transport: &http.Transport{
+			Dial: func(network, address string) (net.Conn, error) {
+				return net.DialTimeout("unix", socket, config.NetworkTimeout)
+			},
+		},
+	}
+
+	return ContainersPoller{
+		measurements: measurements,
+		client:       client,
+		nameLabel:    config.ContainersNameLabel,
+		containers:   make(map[string]*containerState),
+		departed:     make(map[string]*containerDeparted),
+		expiry:       CONTAINERS_DEPARTED_POLLS * config.Interval,
+	}
+}
+
+func (poller ContainersPoller) Poll(tick time.Time) {
+	ctx := slog.Context{"poller": poller.Name(), "fn": "Poll", "tick": tick}
+
+	var containers []dockerContainer
+	if err := poller.get("/containers/json", &containers); err != nil {
+		LogError(ctx, err, "listing containers")
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
+		return
+	}
+
+	stats := poller.containerStats(tick, containers)
+
+	totals := make(map[string]*containerTotals)
+	running := make(map[string]bool) // by container id
+	runningNames := make(map[string]bool)
+
+	for i, container := range containers {
+		name := poller.containerName(container)
+		running[container.Id] = true
+		runningNames[name] = true
+		if stats[i] == nil {
+			continue
+		}
+
+		total, ok := totals[name]
+		if !ok {
+			total = &containerTotals{}
+			totals[name] = total
+		}
+		poller.addStats(tick, total, container.Id, name, *stats[i])
+	}
+
+	// Counters are summed from those last read of every container, so a
+	// failed read doesn't dip them, and those of containers that have gone
+	// away are kept so a name's never go backwards.
+	for id, state := range poller.containers {
+		if !running[id] {
+			poller.depart(tick, state)
+			delete(poller.containers, id)
+			continue
+		}
+		if total, ok := totals[state.name]; ok {
+			total.counters.add(state.counters)
+		}
+	}
+	for name, total := range totals {
+		if departed, ok := poller.departed[name]; ok {
+			total.counters.add(departed.counters)
+		}
+	}
+
+	// A name's series is taken to have ended once it's had no containers
+	// for a while, so what its departed containers counted can be dropped.
+	for name, departed := range poller.departed {
+		if runningNames[name] {
+			departed.seen = tick
+		} else if tick.Sub(departed.seen) > poller.expiry {
+			delete(poller.departed, name)
+		}
+	}
+
+	names := make([]string, 0, len(totals))
+	for name := range totals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"count"}, uint64(len(containers)), Containers}
+	for _, name := range names {
+		poller.report(tick, name, totals[name])
+	}
+}
+
+// containerName names a container by the label chosen, falling back to its
+// name, without the leading /.
+func (poller ContainersPoller) containerName(container dockerContainer) string {
+	name := container.Id
+	if len(container.Names) > 0 {
+		name = strings.TrimPrefix(container.Names[0], "/")
+	}
+	if value, ok := container.Labels[poller.nameLabel]; ok && poller.nameLabel != "" && value != "" {
+		name = value
+	}
+	return sanitizeMetricName(name)
+}
+
+// containerStats gets the stats of each of containers, a few at a time so a
+// slow one doesn't hold up the rest. Those that couldn't be read, as when
+// the container has stopped since it was listed, are nil.
+func (poller ContainersPoller) containerStats(tick time.Time, containers []dockerContainer) []*dockerStats {
+	stats := make([]*dockerStats, len(containers))
+	sem := make(chan struct{}, CONTAINERS_STATS_CONCURRENCY)
+	var wg sync.WaitGroup
+
+	for i, container := range containers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			var s dockerStats
+			if err := poller.get("/containers/"+url.PathEscape(id)+"/stats?stream=false&one-shot=true", &s); err != nil {
+				LogError(slog.Context{"poller": poller.Name(), "fn": "containerStats", "tick": tick, "container": id}, err, "reading container stats")
+				return
+			}
+			stats[i] = &s
+		}(i, container.Id)
+	}
+
+	wg.Wait()
+	return stats
+}
+
+func (poller ContainersPoller) addStats(tick time.Time, total *containerTotals, id, name string, stats dockerStats) {
+	usage := stats.CPUStats.CPUUsage
+	current := containerCpu{tick, usage.TotalUsage, usage.UsageInUsermode, usage.UsageInKernelmode}
+
+	state, ok := poller.containers[id]
+	if !ok {
+		state = &containerState{name: name}
+		poller.containers[id] = state
+	} else if state.name != name {
+		// relabelled, so it leaves its counters with its old name
+		poller.depart(tick, state)
+		state.name = name
+	}
+
+	if last := state.cpu; ok && current.tick.After(last.tick) && current.total >= last.total {
+		elapsed := float64(current.tick.Sub(last.tick).Nanoseconds())
+		total.cpuUsage += float64(current.total-last.total) * 100.0 / elapsed
+		if current.user >= last.user && current.system >= last.system {
+			total.cpuUser += float64(current.user-last.user) * 100.0 / elapsed
+			total.cpuSystem += float64(current.system-last.system) * 100.0 / elapsed
+		}
+		total.cpuSeen = true
+	}
+	state.cpu = current
+
+	total.count++
+	total.memUsage += stats.memoryUsage()
+	total.memLimit += stats.MemoryStats.Limit
+	total.pids += stats.PidsStats.Current
+
+	counters := containerCounters{
+		throttledPeriods: stats.CPUStats.ThrottlingData.ThrottledPeriods,
+		readBytes:        blkioTotal(stats.BlkioStats.IoServiceBytesRecursive, "read"),
+		writeBytes:       blkioTotal(stats.BlkioStats.IoServiceBytesRecursive, "write"),
+		readOps:          blkioTotal(stats.BlkioStats.IoServicedRecursive, "read"),
+		writeOps:         blkioTotal(stats.BlkioStats.IoServicedRecursive, "write"),
+	}
+	for _, net := range stats.Networks {
+		counters.add(containerCounters{net: net})
+	}
+	state.counters = counters
+}
+
+// depart keeps the last counters of a container that's no longer counted
+// under its name
+func (poller ContainersPoller) depart(tick time.Time, state *containerState) {
+	departed, ok := poller.departed[state.name]
+	if !ok {
+		departed = &containerDeparted{}
+		poller.departed[state.name] = departed
+	}
+	departed.counters.add(state.counters)
+	departed.seen = tick
+}
+
+func (poller ContainersPoller) report(tick time.Time, name string, total *containerTotals) {
+	poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{name, "count"}, total.count, Containers}
+
+	if total.cpuSeen {
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{name, "cpu", "usage"}, total.cpuUsage, Percent}
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{name, "cpu", "user"}, total.cpuUser, Percent}
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{name, "cpu", "system"}, total.cpuSystem, Percent}
+	}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "cpu", "throttled", "periods"}, total.counters.throttledPeriods, Empty}
+
+	poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{name, "mem", "usage"}, total.memUsage, Bytes}
+	poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{name, "mem", "limit"}, total.memLimit, Bytes}
+	if total.memLimit > 0 {
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{name, "mem", "perc"}, 100.0 * float64(total.memUsage) / float64(total.memLimit), Percent}
+	}
+
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "net", "receive", "bytes"}, total.counters.net.RxBytes, Bytes}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "net", "receive", "packets"}, total.counters.net.RxPackets, Packets}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "net", "receive", "errors"}, total.counters.net.RxErrors, Errors}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "net", "receive", "dropped"}, total.counters.net.RxDropped, Packets}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "net", "transmit", "bytes"}, total.counters.net.TxBytes, Bytes}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "net", "transmit", "packets"}, total.counters.net.TxPackets, Packets}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "net", "transmit", "errors"}, total.counters.net.TxErrors, Errors}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "net", "transmit", "dropped"}, total.counters.net.TxDropped, Packets}
+
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "read", "bytes"}, total.counters.readBytes, Bytes}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "write", "bytes"}, total.counters.writeBytes, Bytes}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "read", "ops"}, total.counters.readOps, Ops}
+	poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{name, "io", "write", "ops"}, total.counters.writeOps, Ops}
+
+	poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{name, "pids", "current"}, total.pids, Processes}
+}
+
+// get decodes the JSON response to a GET of path from the engine API
+func (poller ContainersPoller) get(path string, v interface{}) error {
+	resp, err := poller.client.Get("http://" + CONTAINERS_API_HOST + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Response returned a %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (poller ContainersPoller) Name() string {
+	return "containers"
+}
+
+func (poller ContainersPoller) Exit() {}
@@ -0,0 +1,152 @@
+package shh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var sampleContainers = `[
+  {"Id": "aaaa", "Names": ["/web.1"], "Labels": {"com.docker.compose.service": "web"}},
+  {"Id": "bbbb", "Names": ["/web.2"], "Labels": {"com.docker.compose.service": "web"}},
+  {"Id": "cccc", "Names": ["/db"], "Labels": {}}
+]`
+
+// sampleContainerStats is a trimmed stats response, on cgroup v1, with CPU
+// usage in seconds.
+func sampleContainerStats(cpuSeconds int) string {
+	return fmt.Sprintf(`{
+  "cpu_stats": {"cpu_usage": {"total_usage": %d, "usage_in_kernelmode": %d, "usage_in_usermode": %d}, "throttling_data": {"throttled_periods": 4}},
+  "memory_stats": {"usage": 3000, "limit": 10000, "stats": {"total_inactive_file": 1000}},
+  "networks": {"eth0": {"rx_bytes": 100, "tx_bytes": 50, "rx_packets": 2}, "eth1": {"rx_bytes": 10, "tx_bytes": 5}},
+  "blkio_stats": {"io_service_bytes_recursive": [{"op": "Read", "value": 4096}, {"op": "Write", "value": 512}, {"op": "Total", "value": 4608}],
+                  "io_serviced_recursive": [{"op": "Read", "value": 2}, {"op": "Write", "value": 1}]},
+  "pids_stats": {"current": 3}
+}`, cpuSeconds*1e9, cpuSeconds*1e9/4, cpuSeconds*1e9*3/4)
+}
+
+func TestContainersPoller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-containers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpuSeconds := 1
+	containers := sampleContainers
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/containers/json":
+			w.Write([]byte(containers))
+		case r.URL.Path == "/containers/cccc/stats":
+			http.Error(w, "gone", http.StatusNotFound)
+		case strings.HasSuffix(r.URL.Path, "/stats"):
+			if r.URL.Query().Get("stream") != "false" {
+				t.Errorf("Should have asked for a single sample, got %s", r.URL)
+			}
+			w.Write([]byte(sampleContainerStats(cpuSeconds)))
+		default:
+			t.Errorf("unexpected request: %v", r)
+			http.Error(w, "unexpected request", http.StatusInternalServerError)
+		}
+	}))
+	srv.Listener = listener
+	srv.Start()
+	defer srv.Close()
+
+	config := Config{ContainersSocket: socket, ContainersNameLabel: "com.docker.compose.service", NetworkTimeout: time.Second, Interval: time.Second}
+	poller := NewContainersPoller(nil, config)
+
+	poll := func(tick time.Time) map[string]string {
+		return pollValues(t, func(measurements chan<- Measurement) {
+			poller.measurements = measurements
+			poller.Poll(tick)
+		})
+	}
+
+	now := time.Now()
+	poll(now)
+	cpuSeconds = 2
+	values := poll(now.Add(10 * time.Second))
+
+	expected := map[string]string{
+		"containers.count":                     "3",
+		"containers.web.count":                 "2",
+		"containers.web.cpu.usage":             "20.000000",
+		"containers.web.cpu.user":              "15.000000",
+		"containers.web.cpu.system":            "5.000000",
+		"containers.web.cpu.throttled.periods": "8",
+		"containers.web.mem.usage":             "4000",
+		"containers.web.mem.limit":             "20000",
+		"containers.web.mem.perc":              "20.000000",
+		"containers.web.net.receive.bytes":     "220",
+		"containers.web.net.transmit.bytes":    "110",
+		"containers.web.io.read.bytes":         "8192",
+		"containers.web.io.write.ops":          "2",
+		"containers.web.pids.current":          "6",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+
+	if _, ok := values["containers.db.count"]; ok {
+		t.Errorf("Should not have reported a container whose stats couldn't be read")
+	}
+	if _, ok := poller.containers["cccc"]; ok {
+		t.Errorf("Should not have recorded a container whose stats couldn't be read")
+	}
+
+	// a replica going away leaves its counters in the sums, and its gauges
+	containers = `[{"Id": "aaaa", "Names": ["/web.1"], "Labels": {"com.docker.compose.service": "web"}}]`
+	values = poll(now.Add(20 * time.Second))
+
+	expected = map[string]string{
+		"containers.web.count":                 "1",
+		"containers.web.cpu.throttled.periods": "8",
+		"containers.web.net.receive.bytes":     "220",
+		"containers.web.io.read.bytes":         "8192",
+		"containers.web.mem.usage":             "2000",
+		"containers.web.pids.current":          "3",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s once a replica went away, got %q", name, value, values[name])
+		}
+	}
+	if _, ok := poller.containers["bbbb"]; ok {
+		t.Errorf("Should have forgotten a container that went away")
+	}
+
+	// the counters of departed replicas go once the name has had no
+	// containers for 10 intervals
+	containers = `[]`
+	poll(now.Add(25 * time.Second))
+	if _, ok := poller.departed["web"]; !ok {
+		t.Errorf("Should have kept the counters of web's departed containers")
+	}
+	poll(now.Add(40 * time.Second))
+	if _, ok := poller.departed["web"]; ok {
+		t.Errorf("Should have dropped the counters of web's departed containers once it had none for a while")
+	}
+}
+
+func TestContainersPoller_Unavailable(t *testing.T) {
+	checkPollError(t, "containers", func(measurements chan<- Measurement) {
+		NewContainersPoller(measurements, Config{ContainersSocket: "/nonexistent/docker.sock", NetworkTimeout: time.Second}).Poll(time.Now())
+	})
+}
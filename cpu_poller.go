@@ -9,6 +9,20 @@ const (
 	CPU_DATA = "/proc/stat"
 )
 
+// Per CPU metrics are reported for the aggregate of all CPUs as cpu, and for
+// each CPU as cpu<n> when SHH_CPU_AGGR=false.
+var cpuMetrics = []MetricDescriptor{
+	{"cpu.<cpu>.user", FloatGaugeType, Percent, "Time spent in user mode", ""},
+	{"cpu.<cpu>.nice", FloatGaugeType, Percent, "Time spent in user mode with low priority", ""},
+	{"cpu.<cpu>.system", FloatGaugeType, Percent, "Time spent in kernel mode", ""},
+	{"cpu.<cpu>.idle", FloatGaugeType, Percent, "Time spent idle", ""},
+	{"cpu.<cpu>.iowait", FloatGaugeType, Percent, "Time spent waiting for I/O", ""},
+	{"cpu.<cpu>.irq", FloatGaugeType, Percent, "Time spent servicing interrupts", ""},
+	{"cpu.<cpu>.softirq", FloatGaugeType, Percent, "Time spent servicing softirqs", ""},
+	{"cpu.<cpu>.steal", FloatGaugeType, Percent, "Time stolen by the hypervisor", ""},
+	{"cpu.<cpu>.guest", FloatGaugeType, Percent, "Time spent running guests", ""},
+}
+
 type CpuValues struct {
 	User    float64
 	Nice    float64
@@ -47,6 +61,7 @@ type Cpu struct {
 	measurements  chan<- Measurement
 	AggregateOnly bool
 	last          map[string]CpuValues
+	data          string
 }
 
 func NewCpuPoller(measurements chan<- Measurement, config Config) Cpu {
@@ -54,13 +69,14 @@ func NewCpuPoller(measurements chan<- Measurement, config Config) Cpu {
 		measurements:  measurements,
 		last:          make(map[string]CpuValues),
 		AggregateOnly: config.CpuOnlyAggregate,
+		data:          config.procPath(CPU_DATA),
 	}
 }
 
 func (poller Cpu) Poll(tick time.Time) {
 	var current, percent CpuValues
 
-	for line := range FileLineChannel(CPU_DATA) {
+	for line := range FileLineChannel(poller.data) {
 		if strings.HasPrefix(line, "cpu") {
 			fields := strings.Fields(line)
 			cpu := fields[0]
@@ -8,11 +8,40 @@ import (
 	"github.com/heroku/slog"
 )
 
+const (
+	MOUNTS_DATA      = "/proc/mounts"
+	INIT_MOUNTS_DATA = "/proc/1/mounts"
+)
+
+// Mountpoints are named with their leading / removed and the others replaced
+// with -, or root for /.
+var dfMetrics = []MetricDescriptor{
+	pollerErrorMetric("df"),
+	{"df.<mountpoint>.total.bytes", GaugeType, Bytes, "Size of the filesystem", ""},
+	{"df.<mountpoint>.root.free.bytes", GaugeType, Bytes, "Free space reserved for root", ""},
+	{"df.<mountpoint>.user.free.bytes", GaugeType, Bytes, "Free space available to users", ""},
+	{"df.<mountpoint>.used.bytes", GaugeType, Bytes, "Used space", ""},
+	{"df.<mountpoint>.total.inodes", GaugeType, INodes, "Inodes on the filesystem", ""},
+	{"df.<mountpoint>.free.inodes", GaugeType, INodes, "Free inodes", ""},
+	{"df.<mountpoint>.used.perc", FloatGaugeType, Percent, "Used space as a percentage of the size", "SHH_PERCENTAGES=df"},
+}
+
 type Df struct {
 	measurements chan<- Measurement
 	percentage   bool
 	Types        []string
 	Loop         bool
+	mounts       string
+	hostPath     func(string) string
+}
+
+// mountsPath returns the mount table to read. /proc/mounts is our own, so
+// when looking at another procfs use the table of its init instead.
+func mountsPath(config Config) string {
+	if config.ProcRoot != "" && config.ProcRoot != DEFAULT_PROC_ROOT {
+		return config.procPath(INIT_MOUNTS_DATA)
+	}
+	return config.procPath(MOUNTS_DATA)
 }
 
 func NewDfPoller(measurements chan<- Measurement, config Config) Df {
@@ -21,6 +50,8 @@ func NewDfPoller(measurements chan<- Measurement, config Config) Df {
 		percentage:   SliceContainsString(config.Percentages, "df"),
 		Types:        config.DfTypes,
 		Loop:         config.DfLoop,
+		mounts:       mountsPath(config),
+		hostPath:     config.hostPath,
 	}
 }
 
@@ -30,7 +61,7 @@ func (poller Df) Poll(tick time.Time) {
 	buf := new(syscall.Statfs_t)
 
 	for mp := range poller.mountpointChannel() {
-		err := syscall.Statfs(mp, buf)
+		err := syscall.Statfs(poller.hostPath(mp), buf)
 		if err != nil {
 			ctx["mountpoint"] = mp
 			LogError(ctx, err, "calling Statfs")
@@ -83,7 +114,7 @@ func (poller Df) mountpointChannel() <-chan string {
 	go func(mountpoints chan<- string) {
 		defer close(mountpoints)
 
-		for line := range FileLineChannel("/proc/mounts") {
+		for line := range FileLineChannel(poller.mounts) {
 
 			fields := strings.Fields(line)
 			fsType := fields[2]
@@ -1,7 +1,9 @@
 package shh
 
 import (
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -10,48 +12,218 @@ import (
 )
 
 const (
-	SYS         = "/sys/block/"
-	SECTOR_SIZE = 512
+	SYS             = "/sys/block"
+	PARTITIONS_DATA = "/proc/partitions"
+	SECTOR_SIZE     = 512
 )
 
+var diskMetrics = []MetricDescriptor{
+	pollerErrorMetric("disk"),
+	{"disk.<device>.read.requests", CounterType, Requests, "Reads completed", ""},
+	{"disk.<device>.read.merges", CounterType, Requests, "Reads merged", ""},
+	{"disk.<device>.read.bytes", CounterType, Bytes, "Bytes read", ""},
+	{"disk.<device>.read.ticks", CounterType, MilliSeconds, "Time spent reading", ""},
+	{"disk.<device>.write.requests", CounterType, Requests, "Writes completed", ""},
+	{"disk.<device>.write.merges", CounterType, Requests, "Writes merged", ""},
+	{"disk.<device>.write.bytes", CounterType, Bytes, "Bytes written", ""},
+	{"disk.<device>.write.ticks", CounterType, MilliSeconds, "Time spent writing", ""},
+	{"disk.<device>.in-flight.requests", GaugeType, Requests, "Requests in flight", ""},
+	{"disk.<device>.io.ticks", CounterType, MilliSeconds, "Time spent doing I/O", ""},
+	{"disk.<device>.queue.time", CounterType, MilliSeconds, "Time spent doing I/O, weighted by the requests in flight", ""},
+	{"disk.<device>.discard.requests", CounterType, Requests, "Discards completed, from Linux 4.18", ""},
+	{"disk.<device>.discard.merges", CounterType, Requests, "Discards merged, from Linux 4.18", ""},
+	{"disk.<device>.discard.bytes", CounterType, Bytes, "Bytes discarded, from Linux 4.18", ""},
+	{"disk.<device>.discard.ticks", CounterType, MilliSeconds, "Time spent discarding, from Linux 4.18", ""},
+	{"disk.<device>.flush.requests", CounterType, Requests, "Flushes completed, from Linux 5.5", ""},
+	{"disk.<device>.flush.ticks", CounterType, MilliSeconds, "Time spent flushing, from Linux 5.5", ""},
+	{"disk.<device>.<op>.iops", FloatGaugeType, Ops, "Requests completed per second since the last poll (read, write, discard, flush)", ""},
+	{"disk.<device>.<op>.throughput", FloatGaugeType, Bytes, "Bytes per second since the last poll (read, write, discard)", ""},
+	{"disk.<device>.<op>.await", FloatGaugeType, MilliSeconds, "Average time to complete a request since the last poll, including queueing (read, write, discard, flush)", ""},
+	{"disk.<device>.queue.size", FloatGaugeType, Avg, "Average requests queued or in flight since the last poll", ""},
+	{"disk.<device>.utilization", FloatGaugeType, Percent, "Share of the time since the last poll the device was doing I/O", ""},
+}
+
+// Fields of /sys/block/<device>/stat, in order. Older kernels have fewer.
+const (
+	DISK_READ_IOS = iota
+	DISK_READ_MERGES
+	DISK_READ_SECTORS
+	DISK_READ_TICKS
+	DISK_WRITE_IOS
+	DISK_WRITE_MERGES
+	DISK_WRITE_SECTORS
+	DISK_WRITE_TICKS
+	DISK_IN_FLIGHT
+	DISK_IO_TICKS
+	DISK_TIME_IN_QUEUE
+	DISK_DISCARD_IOS
+	DISK_DISCARD_MERGES
+	DISK_DISCARD_SECTORS
+	DISK_DISCARD_TICKS
+	DISK_FLUSH_IOS
+	DISK_FLUSH_TICKS
+)
+
+// diskOp is where to find the fields for one kind of request in the stat
+// file, with a sectors of -1 for flushes, which don't transfer any data.
+type diskOp struct {
+	name                string
+	ios, sectors, ticks int
+}
+
+var diskOps = []diskOp{
+	{"read", DISK_READ_IOS, DISK_READ_SECTORS, DISK_READ_TICKS},
+	{"write", DISK_WRITE_IOS, DISK_WRITE_SECTORS, DISK_WRITE_TICKS},
+	{"discard", DISK_DISCARD_IOS, DISK_DISCARD_SECTORS, DISK_DISCARD_TICKS},
+	{"flush", DISK_FLUSH_IOS, -1, DISK_FLUSH_TICKS},
+}
+
+// diskDevice is a block device the disk poller reports on
+type diskDevice struct {
+	kernel     string // the kernel's name, e.g. dm-3
+	name       string // used in metric names, e.g. vg0-data
+	stat       string // path of the stat file
+	mountpoint string // that the device backs, with SHH_DISK_MOUNTS
+}
+
+// diskSample is the stat of a device at a poll, to derive rates from at the
+// next one
+type diskSample struct {
+	stat []uint64
+	tick time.Time
+}
+
 type Disk struct {
 	measurements chan<- Measurement
 	diskFilter   *regexp.Regexp
+	sys          string
+	partitions   string
+	withParts    bool
+	mounts       string                // mount table, when tagging with mountpoints
+	last         map[string]diskSample // by kernel name
 }
 
 func NewDiskPoller(measurements chan<- Measurement, config Config) Disk {
-	return Disk{measurements: measurements, diskFilter: config.DiskFilter}
+	mounts := ""
+	if config.DiskMounts {
+		mounts = mountsPath(config)
+	}
+
+	return Disk{
+		measurements: measurements,
+		diskFilter:   config.DiskFilter,
+		sys:          config.sysPath(SYS),
+		partitions:   config.procPath(PARTITIONS_DATA),
+		withParts:    config.DiskPartitions,
+		mounts:       mounts,
+		last:         make(map[string]diskSample),
+	}
 }
 
 // http://www.kernel.org/doc/Documentation/block/stat.txt
 func (poller Disk) Poll(tick time.Time) {
 	ctx := slog.Context{"poller": poller.Name(), "fn": "Poll", "tick": tick}
+	seen := make(map[string]bool)
 
-	for device := range deviceChannel(poller.diskFilter) {
-		target := SYS + device + "/stat"
-		statBytes, err := ioutil.ReadFile(target)
+	for device := range poller.deviceChannel() {
+		statBytes, err := ioutil.ReadFile(device.stat)
 		if err != nil {
-			LogError(ctx, err, "reading"+target)
+			LogError(ctx, err, "reading "+device.stat)
 			poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
 			continue
 		}
 
 		fields := strings.Fields(string(statBytes))
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "read", "requests"}, Atouint64(fields[0]), Requests}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "read", "merges"}, Atouint64(fields[1]), Requests}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "read", "bytes"}, Atouint64(fields[2]) * SECTOR_SIZE, Bytes}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "read", "ticks"}, Atouint64(fields[3]), MilliSeconds}
-
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "write", "requests"}, Atouint64(fields[4]), Requests}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "write", "merges"}, Atouint64(fields[5]), Requests}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "write", "bytes"}, Atouint64(fields[6]) * SECTOR_SIZE, Bytes}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "write", "ticks"}, Atouint64(fields[7]), MilliSeconds}
-
-		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{device, "in_flight", "requests"}, Atouint64(fields[8]), Requests}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "io", "ticks"}, Atouint64(fields[9]), MilliSeconds}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "queue", "time"}, Atouint64(fields[10]), MilliSeconds}
+		if len(fields) <= DISK_TIME_IN_QUEUE {
+			LogError(ctx, fmt.Errorf("%d fields", len(fields)), "parsing "+device.stat)
+			poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
+			continue
+		}
+		stat := make([]uint64, len(fields))
+		for i, field := range fields {
+			stat[i] = Atouint64(field)
+		}
+
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "read", "requests"}, stat[DISK_READ_IOS], Requests})
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "read", "merges"}, stat[DISK_READ_MERGES], Requests})
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "read", "bytes"}, stat[DISK_READ_SECTORS] * SECTOR_SIZE, Bytes})
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "read", "ticks"}, stat[DISK_READ_TICKS], MilliSeconds})
+
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "write", "requests"}, stat[DISK_WRITE_IOS], Requests})
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "write", "merges"}, stat[DISK_WRITE_MERGES], Requests})
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "write", "bytes"}, stat[DISK_WRITE_SECTORS] * SECTOR_SIZE, Bytes})
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "write", "ticks"}, stat[DISK_WRITE_TICKS], MilliSeconds})
+
+		poller.send(device, GaugeMeasurement{tick, poller.Name(), []string{device.name, "in_flight", "requests"}, stat[DISK_IN_FLIGHT], Requests})
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "io", "ticks"}, stat[DISK_IO_TICKS], MilliSeconds})
+		poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "queue", "time"}, stat[DISK_TIME_IN_QUEUE], MilliSeconds})
+
+		if len(stat) > DISK_DISCARD_TICKS {
+			poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "discard", "requests"}, stat[DISK_DISCARD_IOS], Requests})
+			poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "discard", "merges"}, stat[DISK_DISCARD_MERGES], Requests})
+			poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "discard", "bytes"}, stat[DISK_DISCARD_SECTORS] * SECTOR_SIZE, Bytes})
+			poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "discard", "ticks"}, stat[DISK_DISCARD_TICKS], MilliSeconds})
+		}
+		if len(stat) > DISK_FLUSH_TICKS {
+			poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "flush", "requests"}, stat[DISK_FLUSH_IOS], Requests})
+			poller.send(device, CounterMeasurement{tick, poller.Name(), []string{device.name, "flush", "ticks"}, stat[DISK_FLUSH_TICKS], MilliSeconds})
+		}
+
+		seen[device.kernel] = true
+		poller.handleDerived(tick, device, diskSample{stat: stat, tick: tick})
+	}
+
+	for device := range poller.last {
+		if !seen[device] {
+			delete(poller.last, device)
+		}
+	}
+}
+
+// handleDerived reports what iostat -x would for device, over the time since
+// the last poll. Nothing is reported for the first poll of a device, or if
+// its counters went backwards, as they do when it is re-attached.
+func (poller Disk) handleDerived(tick time.Time, device diskDevice, sample diskSample) {
+	last, exists := poller.last[device.kernel]
+	poller.last[device.kernel] = sample
+
+	elapsed := sample.tick.Sub(last.tick).Seconds()
+	if !exists || elapsed <= 0 || len(last.stat) != len(sample.stat) {
+		return
+	}
+	delta := make([]uint64, len(sample.stat))
+	for i := range sample.stat {
+		// in_flight is a gauge, so is allowed to go down
+		if i != DISK_IN_FLIGHT && sample.stat[i] < last.stat[i] {
+			return
+		}
+		delta[i] = sample.stat[i] - last.stat[i]
 	}
 
+	for _, op := range diskOps {
+		if op.ticks >= len(delta) {
+			continue
+		}
+		ios := delta[op.ios]
+		poller.send(device, FloatGaugeMeasurement{tick, poller.Name(), []string{device.name, op.name, "iops"}, float64(ios) / elapsed, Ops})
+		if op.sectors >= 0 {
+			poller.send(device, FloatGaugeMeasurement{tick, poller.Name(), []string{device.name, op.name, "throughput"}, float64(delta[op.sectors]*SECTOR_SIZE) / elapsed, Bytes})
+		}
+		await := 0.0
+		if ios > 0 {
+			await = float64(delta[op.ticks]) / float64(ios)
+		}
+		poller.send(device, FloatGaugeMeasurement{tick, poller.Name(), []string{device.name, op.name, "await"}, await, MilliSeconds})
+	}
+
+	elapsedMillis := elapsed * 1000
+	poller.send(device, FloatGaugeMeasurement{tick, poller.Name(), []string{device.name, "queue", "size"}, float64(delta[DISK_TIME_IN_QUEUE]) / elapsedMillis, Avg})
+	// io_ticks can run slightly ahead of the wall clock between polls
+	utilization := float64(delta[DISK_IO_TICKS]) * 100 / elapsedMillis
+	if utilization > 100 {
+		utilization = 100
+	}
+	poller.send(device, FloatGaugeMeasurement{tick, poller.Name(), []string{device.name, "utilization"}, utilization, Percent})
 }
 
 func (poller Disk) Name() string {
@@ -59,26 +231,108 @@ func (poller Disk) Name() string {
 }
 func (poller Disk) Exit() {}
 
-func deviceChannel(filter *regexp.Regexp) <-chan string {
-	c := make(chan string)
+// send emits mm, tagged with the mountpoint device backs, if any
+func (poller Disk) send(device diskDevice, mm Measurement) {
+	if device.mountpoint != "" {
+		mm = TaggedMeasurement{mm, "", map[string]string{"mountpoint": device.mountpoint}}
+	}
+	poller.measurements <- mm
+}
+
+// deviceChannel returns the devices in /proc/partitions that match
+// SHH_DISK_FILTER: whole disks, including NVMe namespaces and device-mapper
+// devices, and with SHH_DISK_PARTITIONS their partitions too. Device-mapper
+// devices are named after their LVM or dm-crypt name, rather than dm-N.
+func (poller Disk) deviceChannel() <-chan diskDevice {
+	c := make(chan diskDevice)
+	mountpoints := poller.mountpoints()
 
-	go func(devices chan<- string) {
+	go func(devices chan<- diskDevice) {
 		defer close(devices)
 
-		for line := range FileLineChannel("/proc/partitions") {
+		for line := range FileLineChannel(poller.partitions) {
 
 			fields := strings.Fields(line)
-			if len(fields) == 0 || fields[0] == "major" {
+			if len(fields) < 4 || fields[0] == "major" {
 				continue
 			}
-
-			if Exists(SYS+fields[3]) && filter.MatchString(fields[3]) {
-				devices <- fields[3]
-			} else {
+			kernel := fields[3]
+			if !poller.diskFilter.MatchString(kernel) {
 				continue
 			}
+
+			stat := filepath.Join(poller.sys, kernel, "stat")
+			if !Exists(stat) {
+				// partitions are only found under the disk they're on
+				if !poller.withParts {
+					continue
+				}
+				matches, _ := filepath.Glob(filepath.Join(poller.sys, "*", kernel, "stat"))
+				if len(matches) == 0 {
+					continue
+				}
+				stat = matches[0]
+			}
+
+			device := diskDevice{kernel: kernel, name: kernel, stat: stat, mountpoint: mountpoints[kernel]}
+			if name := poller.dmName(kernel); name != "" {
+				device.name = sanitizeMetricName(name)
+			}
+			devices <- device
 		}
 	}(c)
 
 	return c
 }
+
+// dmName returns the name of the device-mapper device kernel, or "" if it
+// isn't one
+func (poller Disk) dmName(kernel string) string {
+	name, err := ioutil.ReadFile(filepath.Join(poller.sys, kernel, "dm", "name"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(name))
+}
+
+// mountpoints returns the first mountpoint of each device in the mount
+// table, by kernel name, if SHH_DISK_MOUNTS is set. Devices are mounted as
+// /dev/<kernel name>, or /dev/mapper/<dm name> for device-mapper ones.
+func (poller Disk) mountpoints() map[string]string {
+	mountpoints := make(map[string]string)
+	if poller.mounts == "" {
+		return mountpoints
+	}
+
+	data, err := ioutil.ReadFile(poller.mounts)
+	if err != nil {
+		LogError(slog.Context{"poller": poller.Name(), "fn": "mountpoints"}, err, "reading "+poller.mounts)
+		return mountpoints
+	}
+
+	dms := make(map[string]string)
+	if matches, err := filepath.Glob(filepath.Join(poller.sys, "dm-*")); err == nil {
+		for _, match := range matches {
+			kernel := filepath.Base(match)
+			if name := poller.dmName(kernel); name != "" {
+				dms[name] = kernel
+			}
+		}
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+
+		kernel := strings.TrimPrefix(fields[0], "/dev/")
+		if strings.HasPrefix(kernel, "mapper/") {
+			kernel = dms[strings.TrimPrefix(kernel, "mapper/")]
+		}
+		if _, ok := mountpoints[kernel]; kernel != "" && !ok {
+			mountpoints[kernel] = fields[1]
+		}
+	}
+	return mountpoints
+}
@@ -0,0 +1,143 @@
+package shh
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestDiskPoller_Derived(t *testing.T) {
+	root := newFixture(t, map[string]string{
+		"proc/partitions":    "major minor  #blocks  name\n\n   8        0  104857600 sda\n",
+		"sys/block/sda/stat": "100 0 800 10 50 0 400 20 0 30 30 4 0 64 8 10 5\n",
+	})
+
+	poll := func(poller Disk, tick time.Time) map[string]string {
+		return pollValues(t, func(measurements chan<- Measurement) {
+			poller.measurements = measurements
+			poller.Poll(tick)
+		})
+	}
+
+	config := Config{ProcRoot: root + "/proc", SysRoot: root + "/sys", DiskFilter: regexp.MustCompile(DEFAULT_DISK_FILTER)}
+	poller := NewDiskPoller(nil, config)
+	tick := time.Now()
+
+	values := poll(poller, tick)
+	if values["disk.sda.discard.bytes"] != "32768" || values["disk.sda.flush.requests"] != "10" {
+		t.Errorf("Should have reported the discard and flush fields, got %v", values)
+	}
+	if _, ok := values["disk.sda.utilization"]; ok {
+		t.Errorf("Should not have reported derived metrics on the first poll")
+	}
+
+	// over 2s: 200 reads of 400KiB taking 600ms, 100 writes of 200KiB
+	// taking 1s, busy for 1.5s with 3s of requests queued
+	writeFixture(t, root, map[string]string{
+		"sys/block/sda/stat": "300 0 1600 610 150 0 800 1020 2 1530 3030 4 0 64 8 10 5\n",
+	})
+	values = poll(poller, tick.Add(2*time.Second))
+
+	expected := map[string]string{
+		"disk.sda.read.iops":          "100.000000",
+		"disk.sda.read.throughput":    "204800.000000",
+		"disk.sda.read.await":         "3.000000",
+		"disk.sda.write.iops":         "50.000000",
+		"disk.sda.write.throughput":   "102400.000000",
+		"disk.sda.write.await":        "10.000000",
+		"disk.sda.discard.iops":       "0.000000",
+		"disk.sda.flush.await":        "0.000000",
+		"disk.sda.queue.size":         "1.500000",
+		"disk.sda.utilization":        "75.000000",
+		"disk.sda.in-flight.requests": "2",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+	if _, ok := values["disk.sda.flush.throughput"]; ok {
+		t.Errorf("Should not have reported throughput for flushes")
+	}
+
+	// the device was re-attached, resetting its counters
+	writeFixture(t, root, map[string]string{
+		"sys/block/sda/stat": "1 0 8 1 0 0 0 0 0 1 1 0 0 0 0 0 0\n",
+	})
+	values = poll(poller, tick.Add(4*time.Second))
+	if _, ok := values["disk.sda.utilization"]; ok {
+		t.Errorf("Should not have reported derived metrics when the counters went backwards")
+	}
+}
+
+func TestDiskPoller_Devices(t *testing.T) {
+	stat := "1 0 8 1 2 0 16 2 0 3 3\n"
+	root := newFixture(t, map[string]string{
+		"proc/partitions": "major minor  #blocks  name\n\n" +
+			"   8        0  104857600 sda\n   8        1  104856576 sda1\n" +
+			" 259        0  524288000 nvme0n1\n 259        1  524287000 nvme0n1p1\n" +
+			" 253        0  209715200 dm-0\n   7        0      65536 loop0\n",
+		"proc/1/mounts": "/dev/nvme0n1p1 / ext4 rw,relatime 0 0\n" +
+			"/dev/mapper/vg0-data /data xfs rw,relatime 0 0\n" +
+			"/dev/nvme0n1p1 /mnt/bind ext4 rw,relatime 0 0\n" +
+			"proc /proc proc rw 0 0\n",
+		"sys/block/sda/stat":               stat,
+		"sys/block/sda/sda1/stat":          stat,
+		"sys/block/nvme0n1/stat":           stat,
+		"sys/block/nvme0n1/nvme0n1p1/stat": stat,
+		"sys/block/dm-0/stat":              stat,
+		"sys/block/dm-0/dm/name":           "vg0-data\n",
+		"sys/block/loop0/stat":             stat,
+	})
+
+	poll := func(config Config) map[string]map[string]string {
+		measurements := make(chan Measurement, 200)
+		NewDiskPoller(measurements, config).Poll(time.Now())
+		close(measurements)
+
+		// tags by name
+		tags := make(map[string]map[string]string)
+		for mm := range measurements {
+			tags[mm.Name("")] = nil
+			if tagged, ok := mm.(TaggedMeasurement); ok {
+				tags[mm.Name("")] = tagged.Tags()
+			}
+		}
+		return tags
+	}
+
+	config := Config{ProcRoot: root + "/proc", SysRoot: root + "/sys", DiskFilter: regexp.MustCompile(DEFAULT_DISK_FILTER)}
+	tags := poll(config)
+	for _, name := range []string{"disk.sda.read.requests", "disk.nvme0n1.read.requests", "disk.vg0-data.read.requests"} {
+		if _, ok := tags[name]; !ok {
+			t.Errorf("Should have reported %s", name)
+		}
+	}
+	for _, name := range []string{"disk.sda1.read.requests", "disk.nvme0n1p1.read.requests", "disk.dm-0.read.requests", "disk.loop0.read.requests"} {
+		if _, ok := tags[name]; ok {
+			t.Errorf("Should not have reported %s", name)
+		}
+	}
+	if tags["disk.vg0-data.read.requests"] != nil {
+		t.Errorf("Should not have tagged metrics without SHH_DISK_MOUNTS")
+	}
+
+	config.DiskPartitions = true
+	config.DiskMounts = true
+	tags = poll(config)
+	expected := map[string]string{
+		"disk.sda.read.requests":       "",
+		"disk.sda1.read.requests":      "",
+		"disk.nvme0n1.read.requests":   "",
+		"disk.nvme0n1p1.read.requests": "/",
+		"disk.vg0-data.read.requests":  "/data",
+	}
+	for name, mountpoint := range expected {
+		got, ok := tags[name]
+		if !ok {
+			t.Errorf("Should have reported %s", name)
+		} else if got["mountpoint"] != mountpoint {
+			t.Errorf("Should have tagged %s with mountpoint %q, got %v", name, mountpoint, got)
+		}
+	}
+}
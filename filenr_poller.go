@@ -17,18 +17,26 @@ const (
 // Note: file descriptors are a per process concept, and are only
 // mildly-related to this poller.
 
+var filenrMetrics = []MetricDescriptor{
+	{"filenr.alloc", GaugeType, Files, "Allocated file handles", ""},
+	{"filenr.free", GaugeType, Files, "Allocated but unused file handles", ""},
+	{"filenr.max", GaugeType, Files, "Maximum number of file handles", ""},
+}
+
 type FileNr struct {
 	measurements chan<- Measurement
+	data         string
 }
 
-func NewFileNrPoller(measurements chan<- Measurement) FileNr {
+func NewFileNrPoller(measurements chan<- Measurement, config Config) FileNr {
 	return FileNr{
 		measurements: measurements,
+		data:         config.procPath(FILE_NR_DATA),
 	}
 }
 
 func (poller FileNr) Poll(tick time.Time) {
-	for line := range FileLineChannel(FILE_NR_DATA) {
+	for line := range FileLineChannel(poller.data) {
 		fields := strings.Split(strings.Trim(line, "\n"), "\t")
 		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"alloc"}, Atouint64(fields[0]), Files}
 		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"free"}, Atouint64(fields[1]), Files}
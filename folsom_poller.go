@@ -13,6 +13,38 @@ import (
 	"github.com/heroku/slog"
 )
 
+var folsomMetrics = []MetricDescriptor{
+	{"folsom.mem.total", GaugeType, Bytes, "Memory allocated by the Erlang VM", ""},
+	{"folsom.mem.procs.total", GaugeType, Bytes, "Memory allocated for processes", ""},
+	{"folsom.mem.procs.used", GaugeType, Bytes, "Memory used by processes", ""},
+	{"folsom.mem.system", GaugeType, Bytes, "Memory allocated for the VM itself", ""},
+	{"folsom.mem.atom.total", GaugeType, Bytes, "Memory allocated for atoms", ""},
+	{"folsom.mem.atom.used", GaugeType, Bytes, "Memory used by atoms", ""},
+	{"folsom.mem.binary", GaugeType, Bytes, "Memory allocated for binaries", ""},
+	{"folsom.mem.code", GaugeType, Bytes, "Memory allocated for code", ""},
+	{"folsom.mem.ets", GaugeType, Bytes, "Memory allocated for ETS tables", ""},
+	{"folsom.stats.context-switches", CounterType, ContextSwitches, "Context switches", ""},
+	{"folsom.stats.gc.num", CounterType, Empty, "Garbage collections", ""},
+	{"folsom.stats.gc.reclaimed", CounterType, Words, "Words reclaimed by garbage collection", ""},
+	{"folsom.stats.io.input", CounterType, Bytes, "Bytes received through ports", ""},
+	{"folsom.stats.io.output", CounterType, Bytes, "Bytes sent through ports", ""},
+	{"folsom.stats.reductions", GaugeType, Reductions, "Reductions since the last poll", ""},
+	{"folsom.stats.run-queue", GaugeType, Processes, "Processes ready to run", ""},
+	{"folsom.stats.runtime", GaugeType, MilliSeconds, "Runtime since the last poll", ""},
+	{"folsom.stats.wall-clock", GaugeType, MilliSeconds, "Wall clock time since the last poll", ""},
+	{"folsom.stats.sched-util", GaugeType, Percent, "Scheduler utilization", ""},
+	{"folsom.ets.<table>.memory", GaugeType, Words, "Memory used by the ETS table", ""},
+	{"folsom.ets.<table>.size", GaugeType, Terms, "Objects in the ETS table", ""},
+	{"folsom.<histogram>.n", GaugeType, Empty, "Samples in the folsom histogram", ""},
+	{"folsom.<histogram>.max", FloatGaugeType, Empty, "Largest sample in the folsom histogram", ""},
+	{"folsom.<histogram>.median", FloatGaugeType, Empty, "Median of the folsom histogram", ""},
+	{"folsom.<histogram>.p95", FloatGaugeType, Empty, "95th percentile of the folsom histogram", ""},
+	{"folsom.<histogram>.p99", FloatGaugeType, Empty, "99th percentile of the folsom histogram", ""},
+	{"folsom.<metric>", CounterType, Empty, "A folsom counter", ""},
+	{"folsom.<metric>", GaugeType, Empty, "A folsom gauge", ""},
+	{"folsom.<metric>", FloatGaugeType, Empty, "A folsom gauge with a fractional value", ""},
+}
+
 type FolsomEts struct {
 	Memory uint64 `json:"memory"`
 	Name   string `json:"name"`
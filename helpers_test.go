@@ -0,0 +1,62 @@
+package shh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFixture writes files, by their paths relative to dir, creating the
+// directories they're in.
+func writeFixture(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newFixture writes files into a new temporary directory, removed once the
+// test is done, and returns its path.
+func newFixture(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "shh-fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	writeFixture(t, dir, files)
+	return dir
+}
+
+// pollValues calls poll with a channel to send measurements to and returns
+// their values by name, checking that each is described.
+func pollValues(t *testing.T, poll func(measurements chan<- Measurement)) map[string]string {
+	measurements := make(chan Measurement, 1000)
+	poll(measurements)
+	close(measurements)
+
+	values := make(map[string]string)
+	for mm := range measurements {
+		values[mm.Name("")] = mm.StrValue()
+		md, ok := DescribeMeasurement(mm)
+		if !ok || md.Type != mm.Type() {
+			t.Errorf("Should have described %s", mm.Name(""))
+		}
+	}
+	return values
+}
+
+// checkPollError checks that poll reports nothing but the error metric of
+// the poller named name.
+func checkPollError(t *testing.T, name string, poll func(measurements chan<- Measurement)) {
+	values := pollValues(t, poll)
+	if len(values) != 1 || values[name+".error"] != "1" {
+		t.Errorf("Should have reported only %s.error, got %v", name, values)
+	}
+}
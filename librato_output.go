@@ -12,11 +12,12 @@ import (
 )
 
 type LibratoMetric struct {
-	Name       string             `json:"name"`
-	Value      interface{}        `json:"value"`
-	When       int64              `json:"measure_time"`
-	Source     string             `json:"source,omitempty"`
-	Attributes LibratoMetricAttrs `json:"attributes,omitempty"`
+	Name        string             `json:"name"`
+	Value       interface{}        `json:"value"`
+	When        int64              `json:"measure_time"`
+	Source      string             `json:"source,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Attributes  LibratoMetricAttrs `json:"attributes,omitempty"`
 }
 
 type LibratoMetricAttrs struct {
@@ -139,7 +140,19 @@ func (out *Librato) appendLibratoMetric(counters, gauges []LibratoMetric, mm Mea
 		t = mm.Time().Unix()
 	}
 
-	libratoMetric := LibratoMetric{mm.Name(out.prefix), mm.Value(), t, out.source, attrs}
+	source := out.source
+	if tm, ok := mm.(TaggedMeasurement); ok && tm.Source() != "" {
+		source = tm.Source()
+	}
+
+	// Librato shows the description alongside the metric. Clients' own
+	// measurements are left for them to describe.
+	var description string
+	if md, ok := DescribeMeasurement(mm); ok && md.Name != listenClientMetric.Name {
+		description = md.Description
+	}
+
+	libratoMetric := LibratoMetric{mm.Name(out.prefix), mm.Value(), t, source, description, attrs}
 
 	switch mm.Type() {
 	case CounterType:
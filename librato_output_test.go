@@ -251,3 +251,21 @@ func TestLibrato_EOF(t *testing.T) {
 		t.Errorf("Request should have only been tried twice, instead it was tried: %d", handler.times)
 	}
 }
+
+func TestLibrato_Description(t *testing.T) {
+	out := &Librato{prefix: "shh"}
+	now := time.Now()
+
+	counters, gauges := out.appendLibratoMetric(nil, nil, FloatGaugeMeasurement{now, "load", []string{"1m"}, 0.5, Avg})
+	counters, gauges = out.appendLibratoMetric(counters, gauges, GaugeMeasurement{now, "listen", []string{"beverly", "hills"}, 1, Empty})
+
+	if len(gauges) != 2 || len(counters) != 0 {
+		t.Fatalf("Should have appended 2 gauges, got gauges=%+v counters=%+v", gauges, counters)
+	}
+	if gauges[0].Description != loadMetrics[1].Description {
+		t.Errorf("Should have described shh.load.1m as %q, got %q", loadMetrics[1].Description, gauges[0].Description)
+	}
+	if gauges[1].Description != "" {
+		t.Errorf("Should not have described a listened for metric, got %q", gauges[1].Description)
+	}
+}
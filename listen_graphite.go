@@ -0,0 +1,62 @@
+package shh
+
+/*
+
+Graphite plaintext format for the listen poller, selected with the graphite
+format in SHH_LISTEN, e.g. "tcp,127.0.0.1:2003,graphite".
+
+Format: <name>[;<tag>=<value>...] <value> [<unix timestamp>]\n
+
+Graphite has no notion of counters, so values are reported as gauges. A
+missing timestamp, or one of -1, means the time the line was received.
+
+*/
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (poller *Listen) parseGraphiteLine(line string) ([]Measurement, bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, false, fmt.Errorf("Expected 2 or 3 fields, found %d", len(fields))
+	}
+
+	when := time.Now()
+	if len(fields) == 3 && fields[2] != "-1" {
+		var err error
+		if when, err = poller.parseDate(fields[2]); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Graphite 1.1 tagged series: name;tag1=value1;tag2=value2
+	parts := strings.Split(fields[0], ";")
+	name := MetricNameNormalizer.Replace(parts[0])
+
+	mm, err := poller.newMeasurement(when, name, fields[1], "g", "")
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(parts) == 1 {
+		return []Measurement{mm}, false, nil
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range parts[1:] {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 {
+			return nil, false, fmt.Errorf("%q is an improper tag", tag)
+		}
+		tags[MetricNameNormalizer.Replace(kv[0])] = kv[1]
+	}
+
+	if err := validateTags(tags); err != nil {
+		return nil, false, err
+	}
+
+	return []Measurement{TaggedMeasurement{mm, "", tags}}, false, nil
+}
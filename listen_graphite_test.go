@@ -0,0 +1,53 @@
+package shh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListenPollerGraphiteParser(t *testing.T) {
+	listen := &Listen{}
+
+	mms, _, err := listen.parseGraphiteLine("legacy.cron_job.duration 10 90210")
+	if err != nil {
+		t.Fatalf("Should have successfully parsed!: got=%s", err)
+	}
+	g, ok := mms[0].(GaugeMeasurement)
+	if !ok {
+		t.Fatalf("Should have returned a GaugeMeasurement, got=%T", mms[0])
+	}
+	if g.Name("") != "listen.legacy.cron-job.duration" || g.value != 10 || g.time != time.Unix(90210, 0) {
+		t.Errorf("Unexpected measurement: %s=%s at %s", g.Name(""), g.StrValue(), g.time)
+	}
+
+	mms, _, err = listen.parseGraphiteLine("legacy.load -0.5 -1")
+	if err != nil {
+		t.Fatalf("Should have successfully parsed!: got=%s", err)
+	}
+	if _, ok := mms[0].(FloatGaugeMeasurement); !ok {
+		t.Errorf("Should have returned a FloatGaugeMeasurement, got=%T", mms[0])
+	}
+
+	mms, _, err = listen.parseGraphiteLine("legacy.load;host=db1 1.5")
+	if err != nil {
+		t.Fatalf("Should have successfully parsed!: got=%s", err)
+	}
+	if tm, ok := mms[0].(TaggedMeasurement); !ok || tm.Tags()["host"] != "db1" {
+		t.Errorf("Should have returned a TaggedMeasurement with host=db1, got=%#v", mms[0])
+	}
+
+	failure_cases := []string{
+		"legacy.only.name",
+		"legacy.extra 1 2 3",
+		"legacy.bad.value ten 90210",
+		"legacy.bad.ts 10 yesterday",
+		"legacy%bad 10 90210",
+		"legacy.bad.tag;host 10 90210",
+	}
+
+	for _, fail := range failure_cases {
+		if _, _, err = listen.parseGraphiteLine(fail); err == nil {
+			t.Errorf("%q should have failed, but passed instead!", fail)
+		}
+	}
+}
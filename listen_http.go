@@ -0,0 +1,165 @@
+package shh
+
+/*
+
+HTTP ingestion for the listen poller, selected with the http network in
+SHH_LISTEN, e.g. "http,127.0.0.1:8128".
+
+Measurements are POSTed one per line in the listener's format (shh unless
+given). Bodies sent with a JSON content type are parsed as newline delimited
+JSON, or as a JSON array of objects, in the json format.
+
+  curl -d '1413237616 backup.size 1234 g Bytes,b' http://127.0.0.1:8128/
+
+The response reports how many lines were accepted, and why the others
+weren't:
+
+  {"accepted":1,"errors":[{"line":2,"error":"\"bad name\" is an improper metric name"}]}
+
+If SHH_LISTEN_HTTP_TOKEN is set, requests must carry it as a bearer token.
+Bodies larger than SHH_LISTEN_HTTP_MAX_BYTES are refused. Lines beyond
+SHH_LISTEN_RATE_LIMIT, or with names beyond SHH_LISTEN_MAX_NAMES, are
+dropped, reported as errors and answered with a 429.
+
+*/
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/heroku/slog"
+)
+
+type listenHTTPError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type listenHTTPResponse struct {
+	Accepted int               `json:"accepted"`
+	Errors   []listenHTTPError `json:"errors,omitempty"`
+}
+
+// ServeHTTP serves the HTTP ingestion endpoint on listener until it's closed
+func (poller *Listen) ServeHTTP(listener net.Listener, format listenFormat) {
+	ctx := slog.Context{"poller": poller.Name(), "fn": "ServeHTTP", "addr": listener.Addr()}
+
+	srv := &http.Server{
+		Handler:     poller.httpHandler(format),
+		ReadTimeout: poller.Timeout,
+		ErrorLog:    ErrLogger,
+	}
+
+	err := srv.Serve(listener)
+	if poller.shuttingDown() {
+		LogError(ctx, err, "shutting down")
+		return
+	}
+	LogError(ctx, err, "serving http")
+}
+
+func (poller *Listen) httpHandler(format listenFormat) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint64(&poller.httpRequestCount, 1)
+
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !poller.httpAuthorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="shh"`)
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		if r.ContentLength > poller.httpMaxBytes {
+			http.Error(w, fmt.Sprintf("body is larger than %d bytes", poller.httpMaxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, poller.httpMaxBytes+1))
+		if err != nil {
+			http.Error(w, "reading body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > poller.httpMaxBytes {
+			http.Error(w, fmt.Sprintf("body is larger than %d bytes", poller.httpMaxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		lineFormat := format
+		lines := strings.Split(string(body), "\n")
+
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/json" || mt == "application/x-ndjson" {
+			lineFormat = listenFormats["json"]
+
+			if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+				var objects []json.RawMessage
+				if err := json.Unmarshal(trimmed, &objects); err != nil {
+					http.Error(w, "invalid json: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				lines = make([]string, len(objects))
+				for i, o := range objects {
+					lines[i] = string(o)
+				}
+			}
+		}
+
+		limited := false
+
+		var resp listenHTTPResponse
+		for i, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if !poller.allowLine() {
+				resp.Errors = append(resp.Errors, listenHTTPError{Line: i + 1, Error: "rate limited"})
+				limited = true
+				continue
+			}
+			if _, err := poller.handleLine(line, lineFormat); err != nil {
+				resp.Errors = append(resp.Errors, listenHTTPError{Line: i + 1, Error: err.Error()})
+				limited = limited || err == errTooManyNames
+				continue
+			}
+			resp.Accepted++
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case limited:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case len(resp.Errors) > 0:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// httpAuthorized reports whether r carries the configured bearer token, if
+// there is one.
+func (poller *Listen) httpAuthorized(r *http.Request) bool {
+	if poller.httpToken == "" {
+		return true
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	return subtle.ConstantTimeCompare([]byte(token), []byte(poller.httpToken)) == 1
+}
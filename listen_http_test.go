@@ -0,0 +1,111 @@
+package shh
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postListenHTTP(t *testing.T, h http.Handler, contentType, token, body string) (int, listenHTTPResponse) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp listenHTTPResponse
+	if rec.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Couldn't decode response %q: %s", rec.Body.String(), err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestListenPollerHTTP(t *testing.T) {
+	measurements := make(chan Measurement, 10)
+	listen := &Listen{measurements: measurements, httpToken: "sekrit", httpMaxBytes: 256}
+	h := listen.httpHandler(listenFormats[DEFAULT_LISTEN_FORMAT])
+
+	if code, _ := postListenHTTP(t, h, "", "", "90210 beverly.hills 10"); code != http.StatusUnauthorized {
+		t.Errorf("Expected %d without a token, got=%d", http.StatusUnauthorized, code)
+	}
+
+	if code, _ := postListenHTTP(t, h, "", "wrong", "90210 beverly.hills 10"); code != http.StatusUnauthorized {
+		t.Errorf("Expected %d with the wrong token, got=%d", http.StatusUnauthorized, code)
+	}
+
+	if code, _ := postListenHTTP(t, h, "", "sekrit", strings.Repeat("90210 beverly.hills 10\n", 20)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %d for a large body, got=%d", http.StatusRequestEntityTooLarge, code)
+	}
+
+	code, resp := postListenHTTP(t, h, "text/plain", "sekrit", "90210 beverly.hills 10\n\n90210 beverly hills 10\n90210 beverly.hills.mansions 2.5\n")
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected %d with a bad line, got=%d", http.StatusBadRequest, code)
+	}
+	if resp.Accepted != 2 || len(resp.Errors) != 1 || resp.Errors[0].Line != 3 {
+		t.Errorf("Expected 2 lines accepted and an error on line 3, got=%+v", resp)
+	}
+
+	code, resp = postListenHTTP(t, h, "application/json", "sekrit", `[{"name":"beverly.hills","value":1},{"name":"beverly.hills.pools","value":3}]`)
+	if code != http.StatusOK || resp.Accepted != 2 || len(resp.Errors) != 0 {
+		t.Errorf("Expected a JSON array to be accepted, got code=%d resp=%+v", code, resp)
+	}
+
+	if n := len(measurements); n != 4 {
+		t.Errorf("Expected 4 measurements, got=%d", n)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %d for a GET, got=%d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func TestListenPollerHTTP_RateLimit(t *testing.T) {
+	measurements := make(chan Measurement, 10)
+	listen := &Listen{measurements: measurements, httpMaxBytes: 1024, limiter: newLineLimiter(2)}
+	h := listen.httpHandler(listenFormats[DEFAULT_LISTEN_FORMAT])
+
+	code, resp := postListenHTTP(t, h, "", "", strings.Repeat("90210 beverly.hills 10\n", 5))
+	if code != http.StatusTooManyRequests {
+		t.Errorf("Expected %d beyond the rate limit, got=%d", http.StatusTooManyRequests, code)
+	}
+	if resp.Accepted != 2 || len(resp.Errors) != 3 || resp.Errors[0].Line != 3 {
+		t.Errorf("Expected 2 lines accepted and the rest rate limited, got=%+v", resp)
+	}
+	if listen.rateLimitedCount != 3 {
+		t.Errorf("Expected 3 lines counted as rate limited, got=%d", listen.rateLimitedCount)
+	}
+
+	// the limit is shared, so a new request doesn't get a fresh allowance
+	if code, resp := postListenHTTP(t, h, "", "", "90210 beverly.hills 10\n"); code != http.StatusTooManyRequests || resp.Accepted != 0 {
+		t.Errorf("Expected another request to be rate limited, got code=%d resp=%+v", code, resp)
+	}
+}
+
+func TestListenPollerHTTP_MaxNames(t *testing.T) {
+	measurements := make(chan Measurement, 10)
+	listen := &Listen{measurements: measurements, httpMaxBytes: 1024, names: newListenNames(1)}
+	h := listen.httpHandler(listenFormats[DEFAULT_LISTEN_FORMAT])
+
+	code, resp := postListenHTTP(t, h, "", "", "90210 beverly.hills 10\n90210 bel.air 10\n90210 beverly.hills 11\n")
+	if code != http.StatusTooManyRequests {
+		t.Errorf("Expected %d beyond the names cap, got=%d", http.StatusTooManyRequests, code)
+	}
+	if resp.Accepted != 2 || len(resp.Errors) != 1 || resp.Errors[0].Line != 2 || resp.Errors[0].Error != errTooManyNames.Error() {
+		t.Errorf("Expected the line with a new name reported as an error, got=%+v", resp)
+	}
+	if len(measurements) != 2 {
+		t.Errorf("Expected 2 measurements forwarded, got=%d", len(measurements))
+	}
+}
@@ -0,0 +1,170 @@
+package shh
+
+/*
+
+Influx line protocol for the listen poller, selected with the influx format
+in SHH_LISTEN, e.g. "udp,127.0.0.1:8089,influx".
+
+Format: <measurement>[,<tag>=<value>...] <field>=<value>[,<field>=<value>...] [<unix nano timestamp>]\n
+
+Each field becomes a measurement named <measurement>.<field>:
+
+  1.5   (float)    FloatGauge
+  15i   (integer)  Gauge, or FloatGauge if negative
+  15u   (unsigned) Counter
+  true  (boolean)  Gauge of 1 or 0
+
+String fields can't be represented and are skipped. Tags are kept as tags on
+the measurement, or with SHH_LISTEN_INFLUX_TAGS=flatten, folded into the name
+as <measurement>.<tag values, ordered by tag name>.<field>.
+
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	INFLUX_TAGS_KEEP    = "keep"
+	INFLUX_TAGS_FLATTEN = "flatten"
+)
+
+func (poller *Listen) parseInfluxLine(line string) ([]Measurement, bool, error) {
+	sections := splitInflux(strings.TrimSpace(line), ' ')
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, false, fmt.Errorf("Expected 2 or 3 sections, found %d", len(sections))
+	}
+
+	when := time.Now()
+	if len(sections) == 3 {
+		ns, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid timestamp: %q", sections[2])
+		}
+		when = time.Unix(0, ns)
+	}
+
+	series := splitInflux(sections[0], ',')
+	measurement := unescapeInflux(series[0])
+	if measurement == "" {
+		return nil, false, fmt.Errorf("missing measurement name")
+	}
+
+	tags := make(map[string]string)
+	tagKeys := make([]string, 0, len(series)-1)
+	for _, tag := range series[1:] {
+		kv := splitInflux(tag, '=')
+		if len(kv) != 2 {
+			return nil, false, fmt.Errorf("%q is an improper tag", tag)
+		}
+		k := MetricNameNormalizer.Replace(unescapeInflux(kv[0]))
+		tags[k] = unescapeInflux(kv[1])
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+
+	if err := validateTags(tags); err != nil {
+		return nil, false, err
+	}
+
+	prefix := measurement
+	if poller.flattenInfluxTags {
+		for _, k := range tagKeys {
+			prefix += "." + tags[k]
+		}
+	}
+
+	mms := make([]Measurement, 0)
+	for _, field := range splitInflux(sections[1], ',') {
+		kv := splitInflux(field, '=')
+		if len(kv) != 2 {
+			return nil, false, fmt.Errorf("%q is an improper field", field)
+		}
+
+		name := MetricNameNormalizer.Replace(prefix + "." + unescapeInflux(kv[0]))
+		mm, err := poller.influxMeasurement(when, name, kv[1])
+		if err != nil {
+			return nil, false, err
+		}
+		if mm == nil {
+			continue
+		}
+
+		if len(tags) > 0 && !poller.flattenInfluxTags {
+			mm = TaggedMeasurement{mm, "", tags}
+		}
+		mms = append(mms, mm)
+	}
+
+	if len(mms) == 0 {
+		return nil, false, fmt.Errorf("no numeric fields in %q", sections[1])
+	}
+
+	return mms, false, nil
+}
+
+// influxMeasurement maps a single influx field value onto a measurement. It
+// returns a nil measurement for string fields, which can't be represented.
+func (poller *Listen) influxMeasurement(when time.Time, name, value string) (Measurement, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return nil, nil
+	case value == "t" || value == "T" || value == "true" || value == "True" || value == "TRUE":
+		return poller.newMeasurement(when, name, "1", "g", "")
+	case value == "f" || value == "F" || value == "false" || value == "False" || value == "FALSE":
+		return poller.newMeasurement(when, name, "0", "g", "")
+	case strings.HasSuffix(value, "u"):
+		return poller.newMeasurement(when, name, strings.TrimSuffix(value, "u"), "c", "")
+	case strings.HasSuffix(value, "i"):
+		value = strings.TrimSuffix(value, "i")
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("Couldn't parse %q as value", value)
+		}
+		return poller.newMeasurement(when, name, value, "g", "")
+	default:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("Couldn't parse %q as value", value)
+		}
+		// Influx floats may be written without a decimal point
+		if !strings.ContainsAny(value, ".eE") {
+			value += ".0"
+		}
+		return poller.newMeasurement(when, name, value, "g", "")
+	}
+}
+
+// splitInflux splits s on sep, ignoring separators that are escaped with a
+// backslash or inside a double quoted string.
+func splitInflux(s string, sep byte) []string {
+	parts := make([]string, 0)
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				if i > start || sep != ' ' {
+					parts = append(parts, s[start:i])
+				}
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\"`, `"`, `\\`, `\`)
+
+func unescapeInflux(s string) string {
+	return influxUnescaper.Replace(s)
+}
@@ -0,0 +1,84 @@
+package shh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListenPollerInfluxParser(t *testing.T) {
+	listen := &Listen{}
+
+	_, _, err := listen.parseInfluxLine(`disk,host=db1,path=/var\ lib used=1.5,free=10i,reads=7u,ok=true,label="x y" 1465839830100400200`)
+	if err == nil {
+		t.Fatalf("A tag value with a space should have failed")
+	}
+
+	mms, _, err := listen.parseInfluxLine(`disk,host=db1,dev=sda used=1.5,free=10i,reads=7u,ok=true,label="x y",neg=-2i,whole=3 1465839830100400200`)
+	if err != nil {
+		t.Fatalf("Should have successfully parsed!: got=%s", err)
+	}
+	if len(mms) != 6 {
+		t.Fatalf("Should have returned 6 measurements, got=%d", len(mms))
+	}
+
+	expected := []struct {
+		name string
+		mm   Measurement
+	}{
+		{"listen.disk.used", FloatGaugeMeasurement{}},
+		{"listen.disk.free", GaugeMeasurement{}},
+		{"listen.disk.reads", CounterMeasurement{}},
+		{"listen.disk.ok", GaugeMeasurement{}},
+		{"listen.disk.neg", FloatGaugeMeasurement{}},
+		{"listen.disk.whole", FloatGaugeMeasurement{}},
+	}
+	for i, e := range expected {
+		tm, ok := mms[i].(TaggedMeasurement)
+		if !ok {
+			t.Errorf("%s should have been a TaggedMeasurement, got=%T", e.name, mms[i])
+			continue
+		}
+		if tm.Name("") != e.name {
+			t.Errorf("Expected %s, got=%s", e.name, tm.Name(""))
+		}
+		if tm.Type() != e.mm.Type() {
+			t.Errorf("%s should have been a %T, got=%T", e.name, e.mm, tm.Measurement)
+		}
+		if tm.Tags()["host"] != "db1" || tm.Tags()["dev"] != "sda" {
+			t.Errorf("Unexpected tags: %v", tm.Tags())
+		}
+		if tm.Time() != time.Unix(0, 1465839830100400200) {
+			t.Errorf("Unexpected time: %s", tm.Time())
+		}
+	}
+
+	listen.flattenInfluxTags = true
+	mms, _, err = listen.parseInfluxLine(`net_io,interface=eth0,host=db1 bytes_recv=10u`)
+	if err != nil {
+		t.Fatalf("Should have successfully parsed!: got=%s", err)
+	}
+	if _, ok := mms[0].(CounterMeasurement); !ok {
+		t.Errorf("Should have returned an untagged CounterMeasurement, got=%T", mms[0])
+	}
+	if n := mms[0].Name(""); n != "listen.net-io.db1.eth0.bytes-recv" {
+		t.Errorf("Expected listen.net-io.db1.eth0.bytes-recv, got=%s", n)
+	}
+
+	failure_cases := []string{
+		`disk`,
+		`disk used=1 2 3`,
+		`disk used=abc`,
+		`disk used=1.5i`,
+		`disk used=-1u`,
+		`disk label="only strings"`,
+		`disk,host used=1`,
+		`disk used=1 yesterday`,
+		`di%sk used=1`,
+	}
+
+	for _, fail := range failure_cases {
+		if _, _, err = listen.parseInfluxLine(fail); err == nil {
+			t.Errorf("%q should have failed, but passed instead!", fail)
+		}
+	}
+}
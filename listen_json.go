@@ -0,0 +1,134 @@
+package shh
+
+/*
+
+Newline delimited JSON format for the listen poller, selected with the json
+format in SHH_LISTEN, e.g. "tcp,127.0.0.1:8127,json".
+
+Each line is a single object:
+
+  {"name": "backup.size", "value": 1234, "type": "g", "unit": "Bytes,b",
+   "timestamp": "2014-10-13T22:00:16Z", "source": "db1", "tags": {"role": "primary"},
+   "ack": true}
+
+Only name and value are required. timestamp may be an RFC3339 string or a
+unix timestamp and defaults to the time the line was received. When ack is
+true, shh replies to the line with {"ok":true} or {"ok":false,"error":"..."}.
+
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type listenJSONMeasurement struct {
+	Name      string            `json:"name"`
+	Value     json.Number       `json:"value"`
+	Type      string            `json:"type,omitempty"`
+	Unit      string            `json:"unit,omitempty"`
+	Timestamp json.RawMessage   `json:"timestamp,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Ack       bool              `json:"ack,omitempty"`
+}
+
+type listenAck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// writeListenAck tells the client the outcome of the line it asked to have
+// acknowledged.
+func writeListenAck(w io.Writer, lineErr error) error {
+	ack := listenAck{OK: lineErr == nil}
+	if lineErr != nil {
+		ack.Error = lineErr.Error()
+	}
+	return json.NewEncoder(w).Encode(ack)
+}
+
+func (poller *Listen) parseJSONLine(line string) ([]Measurement, bool, error) {
+	var jm listenJSONMeasurement
+
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&jm); err != nil {
+		return nil, false, fmt.Errorf("invalid json: %s", err)
+	}
+
+	mm, err := poller.jsonMeasurement(jm)
+	if err != nil {
+		return nil, jm.Ack, err
+	}
+	return []Measurement{mm}, jm.Ack, nil
+}
+
+// jsonMeasurement validates a decoded JSON measurement with the same rules
+// as the shh line format and builds it.
+func (poller *Listen) jsonMeasurement(jm listenJSONMeasurement) (Measurement, error) {
+	when, err := poller.parseJSONTimestamp(jm.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	if jm.Value == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	mm, err := poller.newMeasurement(when, jm.Name, jm.Value.String(), jm.Type, jm.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	if jm.Source == "" && len(jm.Tags) == 0 {
+		return mm, nil
+	}
+
+	if jm.Source != "" && !MetricNameRegexp.MatchString(jm.Source) {
+		return nil, fmt.Errorf("%q is an improper source", jm.Source)
+	}
+
+	if err := validateTags(jm.Tags); err != nil {
+		return nil, err
+	}
+
+	return TaggedMeasurement{mm, jm.Source, jm.Tags}, nil
+}
+
+// validateTags checks tags given to the listen poller by a client
+func validateTags(tags map[string]string) error {
+	for k, v := range tags {
+		if !MetricNameRegexp.MatchString(k) {
+			return fmt.Errorf("%q is an improper tag name", k)
+		}
+		if v == "" || strings.ContainsAny(v, " \t\n;=") {
+			return fmt.Errorf("%q is an improper value for tag %q", v, k)
+		}
+	}
+	return nil
+}
+
+// parseJSONTimestamp parses an optional RFC3339 string or unix timestamp
+func (poller *Listen) parseJSONTimestamp(raw json.RawMessage) (time.Time, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return time.Now(), nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return poller.parseDate(s)
+	}
+
+	// A fractional unix timestamp is accepted down to the nanosecond
+	ts, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || ts < 0 {
+		return time.Now(), fmt.Errorf("Invalid timestamp: %s", raw)
+	}
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9)), nil
+}
@@ -0,0 +1,118 @@
+package shh
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestListenPollerJSONParser_HappyPath(t *testing.T) {
+	listen := &Listen{}
+
+	mms, ack, err := listen.parseJSONLine(`{"name":"beverly.hills","value":10,"timestamp":90210}`)
+	if err != nil {
+		t.Fatalf("Should have successfully parsed!: got=%s", err)
+	}
+	if ack {
+		t.Errorf("Should not have asked for an ack")
+	}
+	c, ok := mms[0].(CounterMeasurement)
+	if !ok {
+		t.Fatalf("Should have returned a CounterMeasurement, got=%T", mms[0])
+	}
+	if c.value != 10 || c.time != time.Unix(90210, 0) {
+		t.Errorf("Unexpected measurement: %+v", c)
+	}
+
+	mms, ack, err = listen.parseJSONLine(`{"name":"beverly.hills","value":1.5,"type":"gauge","unit":"Millionaires,$$","timestamp":"2014-10-13T22:00:16Z","source":"zip90210","tags":{"street":"rodeo"},"ack":true}`)
+	if err != nil {
+		t.Fatalf("Should have successfully parsed!: got=%s", err)
+	}
+	if !ack {
+		t.Errorf("Should have asked for an ack")
+	}
+	tm, ok := mms[0].(TaggedMeasurement)
+	if !ok {
+		t.Fatalf("Should have returned a TaggedMeasurement, got=%T", mms[0])
+	}
+	if _, ok := tm.Measurement.(FloatGaugeMeasurement); !ok {
+		t.Errorf("Should have wrapped a FloatGaugeMeasurement, got=%T", tm.Measurement)
+	}
+	if tm.Source() != "zip90210" || tm.Tags()["street"] != "rodeo" {
+		t.Errorf("Unexpected source or tags: source=%q tags=%v", tm.Source(), tm.Tags())
+	}
+	if tm.Unit().Name() != "Millionaires" || tm.Unit().Abbr() != "$$" {
+		t.Errorf("Unit should have been name=Millionaires, abbr=$$, got name=%q abbr=%q", tm.Unit().Name(), tm.Unit().Abbr())
+	}
+}
+
+func TestListenPollerJSONParser_Errors(t *testing.T) {
+	listen := &Listen{}
+
+	failure_cases := []string{
+		`not json`,
+		`{"name":"no.value"}`,
+		`{"name":"has spaces","value":1}`,
+		`{"name":"negative.counter","value":-1,"type":"c"}`,
+		`{"name":"bad.type","value":1,"type":"q"}`,
+		`{"name":"bad.unit","value":1,"unit":"Bad Unit"}`,
+		`{"name":"bad.timestamp","value":1,"timestamp":"yesterday"}`,
+		`{"name":"bad.source","value":1,"source":"-"}`,
+		`{"name":"bad.tag","value":1,"tags":{"a b":"c"}}`,
+		`{"name":"bad.tag.value","value":1,"tags":{"a":""}}`,
+	}
+
+	for _, fail := range failure_cases {
+		if _, _, err := listen.parseJSONLine(fail); err == nil {
+			t.Errorf("%q should have failed, but passed instead!", fail)
+		}
+	}
+}
+
+func TestListenPoller_JSONAcks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "shh.sock")
+	measurements := make(chan Measurement, 2)
+	poller := NewListenPoller(measurements, Config{Listen: "unix," + sock + ",json", ListenTimeout: 5 * time.Second})
+	defer poller.Exit()
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	rdr := bufio.NewReader(conn)
+	for _, tc := range []struct{ line, ack string }{
+		{`{"name":"has spaces","value":1,"ack":true}`, `{"ok":false,"error":"\"has spaces\" is an improper metric name"}`},
+		{`{"name":"beverly.hills","value":1,"ack":true}`, `{"ok":true}`},
+	} {
+		if _, err := conn.Write([]byte(tc.line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		ack, err := rdr.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ack != tc.ack+"\n" {
+			t.Errorf("Expected ack %s, got=%s", tc.ack, ack)
+		}
+	}
+
+	if m := <-measurements; m.Name("") != "listen.beverly.hills" {
+		t.Errorf("Expected listen.beverly.hills, got=%s", m.Name(""))
+	}
+	if n := atomic.LoadUint64(&poller.parseErrorCount); n != 1 {
+		t.Errorf("Expected 1 parse error, got=%d", n)
+	}
+}
@@ -0,0 +1,281 @@
+package shh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// socketPerms is the mode, owner and group given to UNIX sockets the listen
+// poller creates. A uid or gid of -1 leaves it unchanged.
+type socketPerms struct {
+	mode     os.FileMode
+	hasMode  bool
+	uid, gid int
+}
+
+func newSocketPerms(mode, owner, group string) (socketPerms, error) {
+	perms := socketPerms{uid: -1, gid: -1}
+
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return perms, fmt.Errorf("invalid socket mode %q: %s", mode, err)
+		}
+		perms.mode = os.FileMode(m) & os.ModePerm
+		perms.hasMode = true
+	}
+
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			if u, err = user.LookupId(owner); err != nil {
+				return perms, fmt.Errorf("unknown socket owner %q", owner)
+			}
+		}
+		perms.uid, _ = strconv.Atoi(u.Uid)
+	}
+
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return perms, fmt.Errorf("unknown socket group %q", group)
+			}
+		}
+		perms.gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	return perms, nil
+}
+
+// unixPath reports whether addr names a UNIX socket on the filesystem, as
+// opposed to an abstract one.
+func (la listenAddr) unixPath() bool {
+	switch la.network {
+	case "unix", "unixpacket", "unixgram":
+		return !strings.HasPrefix(la.address, "@")
+	}
+	return false
+}
+
+// socketUmask serialises changes to the process wide umask, so that
+// sockets created at the same time restore the right one.
+var socketUmask sync.Mutex
+
+// createSocket removes any stale UNIX socket at addr, calls create and then
+// applies perms to the new socket. When there are perms to apply, the socket
+// is bound with a umask leaving it to shh's user alone until they are.
+func (perms socketPerms) createSocket(addr listenAddr, create func() error) error {
+	if !addr.unixPath() {
+		return create()
+	}
+
+	// If this is a path, remove it
+	if Exists(addr.address) {
+		if err := os.Remove(addr.address); err != nil {
+			return fmt.Errorf("unable to remove old socket path: %s", err)
+		}
+	}
+
+	if !perms.hasMode && perms.uid == -1 && perms.gid == -1 {
+		return create()
+	}
+
+	socketUmask.Lock()
+	umask := syscall.Umask(0177)
+	err := create()
+	syscall.Umask(umask)
+	socketUmask.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if perms.uid != -1 || perms.gid != -1 {
+		if err := os.Chown(addr.address, perms.uid, perms.gid); err != nil {
+			return err
+		}
+	}
+
+	mode := os.FileMode(0777) &^ os.FileMode(umask)
+	if perms.hasMode {
+		mode = perms.mode
+	}
+	return os.Chmod(addr.address, mode)
+}
+
+func (poller *Listen) listenStream(addr listenAddr) (net.Listener, error) {
+	var listener net.Listener
+
+	network := addr.network
+	if network == "http" {
+		network = "tcp"
+	}
+
+	err := poller.perms.createSocket(addr, func() (err error) {
+		listener, err = net.Listen(network, addr.address)
+		return err
+	})
+	return listener, err
+}
+
+func (poller *Listen) listenPacket(addr listenAddr) (net.PacketConn, error) {
+	var conn net.PacketConn
+
+	err := poller.perms.createSocket(addr, func() (err error) {
+		conn, err = net.ListenPacket(addr.network, addr.address)
+		return err
+	})
+	return conn, err
+}
+
+// limitedListener closes connections accepted while the poller already has
+// maxConnections open.
+type limitedListener struct {
+	net.Listener
+	poller *Listen
+}
+
+func (l limitedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		active := atomic.AddInt64(&l.poller.activeConnections, 1)
+		if l.poller.maxConnections > 0 && active > l.poller.maxConnections {
+			atomic.AddInt64(&l.poller.activeConnections, -1)
+			atomic.AddUint64(&l.poller.rejectedConnectionCount, 1)
+			conn.Close()
+			continue
+		}
+
+		return &limitedConn{Conn: conn, poller: l.poller}, nil
+	}
+}
+
+type limitedConn struct {
+	net.Conn
+	poller *Listen
+	once   sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.poller.activeConnections, -1)
+	})
+	return c.Conn.Close()
+}
+
+// lineLimiter is a token bucket allowing rate lines per second, in bursts of
+// up to rate lines. A nil lineLimiter allows everything.
+type lineLimiter struct {
+	sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newLineLimiter(rate int) *lineLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &lineLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (l *lineLimiter) allow(now time.Time) bool {
+	if l == nil {
+		return true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// allowLine applies the rate limit, shared by every listener, to the next
+// line, counting any that are dropped
+func (poller *Listen) allowLine() bool {
+	if poller.limiter.allow(time.Now()) {
+		return true
+	}
+	atomic.AddUint64(&poller.rateLimitedCount, 1)
+	return false
+}
+
+// errTooManyNames is returned for lines whose measurements were dropped, in
+// whole or in part, for exceeding SHH_LISTEN_MAX_NAMES.
+var errTooManyNames = errors.New("too many distinct names this interval")
+
+// listenNames caps the number of distinct names the listen poller accepts
+// between polls. A nil listenNames, or one with a max of 0, admits
+// everything.
+type listenNames struct {
+	sync.Mutex
+	max     int
+	seen    map[string]struct{}
+	dropped uint64
+}
+
+func newListenNames(max int) *listenNames {
+	return &listenNames{max: max, seen: make(map[string]struct{})}
+}
+
+func (ln *listenNames) admit(name string) bool {
+	if ln == nil || ln.max <= 0 {
+		return true
+	}
+
+	ln.Lock()
+	defer ln.Unlock()
+
+	if _, ok := ln.seen[name]; ok {
+		return true
+	}
+	if len(ln.seen) >= ln.max {
+		ln.dropped++
+		return false
+	}
+	ln.seen[name] = struct{}{}
+	return true
+}
+
+func (ln *listenNames) droppedCount() uint64 {
+	if ln == nil {
+		return 0
+	}
+
+	ln.Lock()
+	defer ln.Unlock()
+	return ln.dropped
+}
+
+func (ln *listenNames) reset() {
+	if ln == nil {
+		return
+	}
+
+	ln.Lock()
+	defer ln.Unlock()
+	ln.seen = make(map[string]struct{})
+}
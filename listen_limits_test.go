@@ -0,0 +1,154 @@
+package shh
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLineLimiter(t *testing.T) {
+	var l *lineLimiter
+	if !l.allow(time.Now()) {
+		t.Errorf("A nil limiter should allow everything")
+	}
+
+	now := time.Now()
+	l = &lineLimiter{rate: 2, tokens: 2, last: now}
+	if !l.allow(now) || !l.allow(now) {
+		t.Errorf("Should have allowed a burst of 2")
+	}
+	if l.allow(now) {
+		t.Errorf("Should not have allowed a 3rd line in the same instant")
+	}
+	if !l.allow(now.Add(500 * time.Millisecond)) {
+		t.Errorf("Should have allowed a line after half a second")
+	}
+}
+
+func TestListenNames(t *testing.T) {
+	ln := newListenNames(2)
+	for _, name := range []string{"a", "b", "a", "c", "b"} {
+		ln.admit(name)
+	}
+	if ln.admit("c") || ln.droppedCount() != 2 {
+		t.Errorf("Should have dropped c twice, dropped=%d", ln.droppedCount())
+	}
+
+	ln.reset()
+	if !ln.admit("c") {
+		t.Errorf("Should have admitted c after a reset")
+	}
+
+	if !newListenNames(0).admit("anything") {
+		t.Errorf("A max of 0 should admit everything")
+	}
+}
+
+func TestListenPoller_Limits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "shh.sock")
+	measurements := make(chan Measurement, 10)
+	poller := NewListenPoller(measurements, Config{
+		Listen:               "unix," + sock,
+		ListenTimeout:        5 * time.Second,
+		ListenMaxConnections: 1,
+		ListenSocketMode:     "0600",
+	})
+	defer poller.Exit()
+
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode() & os.ModePerm; mode != 0600 {
+		t.Errorf("Socket mode should have been 0600, was=%o", mode)
+	}
+
+	first, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if _, err := first.Write([]byte("90210 beverly.hills 10\n")); err != nil {
+		t.Fatal(err)
+	}
+	<-measurements
+
+	second, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Errorf("The second connection should have been closed")
+	}
+	if n := atomic.LoadUint64(&poller.rejectedConnectionCount); n != 1 {
+		t.Errorf("Expected 1 rejected connection, got=%d", n)
+	}
+}
+
+func TestSocketPerms_CreateSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "shh.sock")
+	perms := socketPerms{mode: 0666, hasMode: true, uid: -1, gid: os.Getgid()}
+
+	var listener net.Listener
+	err = perms.createSocket(listenAddr{network: "unix", address: sock}, func() (err error) {
+		if listener, err = net.Listen("unix", sock); err != nil {
+			return err
+		}
+		fi, err := os.Stat(sock)
+		if err != nil {
+			return err
+		}
+		if mode := fi.Mode() & os.ModePerm; mode != 0600 {
+			t.Errorf("Socket should have been bound with mode 0600, was=%o", mode)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode() & os.ModePerm; mode != 0666 {
+		t.Errorf("Socket mode should have been 0666, was=%o", mode)
+	}
+}
+
+func TestNewSocketPerms(t *testing.T) {
+	if _, err := newSocketPerms("rw-rw----", "", ""); err == nil {
+		t.Errorf("A symbolic mode should have failed")
+	}
+	if _, err := newSocketPerms("", "no-such-user-shh", ""); err == nil {
+		t.Errorf("An unknown owner should have failed")
+	}
+
+	perms, err := newSocketPerms("660", "0", "0")
+	if err != nil {
+		t.Fatalf("Should have successfully parsed!: got=%s", err)
+	}
+	if !perms.hasMode || perms.mode != 0660 || perms.uid != 0 || perms.gid != 0 {
+		t.Errorf("Unexpected perms: %+v", perms)
+	}
+}
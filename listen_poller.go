@@ -8,6 +8,12 @@ Format: <RFC3339 date stamp> <what> <value>\n
 
 The exact interpretation of these depends on the Outputter in use.
 
+SHH_LISTEN may name several sockets, separated by ;, each of which can
+choose the format it parses, e.g. "unix,#shh;udp,127.0.0.1:8126,shh".
+An http socket accepts the same lines POSTed over HTTP (see listen_http.go).
+Sockets passed by systemd socket activation are used in place of binding a
+matching address, or can be named directly with "systemd,<name>".
+
 Example
 
 In terminal A:
@@ -23,117 +29,315 @@ import (
 	"fmt"
 	"io"
 	"net"
-	"os"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/heroku/shh/client"
 	"github.com/heroku/slog"
 )
 
 var (
-	MetricNameRegexp = regexp.MustCompile("^[a-zA-Z0-9]([a-zA-Z0-9.-]+)?$")
-	UnitRegexp       = regexp.MustCompile("^([a-zA-Z$%#]+)(,([a-zA-Z$%#]+))?$") // <unit 1>,<abbr 3>
+	// Shared with the client package, so clients validate as shh does
+	MetricNameRegexp = client.MetricNameRegexp
+	UnitRegexp       = client.UnitRegexp // <unit 1>,<abbr 3>
 )
 
+// listenFormat parses a single line received by the listen poller into
+// measurements. ack reports whether the client asked to be told the outcome
+// of the line.
+type listenFormat func(poller *Listen, line string) (mms []Measurement, ack bool, err error)
+
+var listenFormats = map[string]listenFormat{
+	DEFAULT_LISTEN_FORMAT: (*Listen).parseShhLine,
+	"json":                (*Listen).parseJSONLine,
+	"graphite":            (*Listen).parseGraphiteLine,
+	"influx":              (*Listen).parseInfluxLine,
+}
+
+// listenAddr is a single <net>,<addr>[,<format>] entry from SHH_LISTEN
+type listenAddr struct {
+	network string
+	address string
+	format  string
+}
+
+func (la listenAddr) String() string {
+	return la.network + "," + la.address + "," + la.format
+}
+
+// datagram reports whether the network is packet, rather than
+// connection, oriented.
+func (la listenAddr) datagram() bool {
+	switch la.network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
+
+// parseListenAddrs parses a semicolon separated list of
+// <net>,<addr>[,<format>] entries, as found in SHH_LISTEN.
+func parseListenAddrs(spec string) ([]listenAddr, error) {
+	addrs := make([]listenAddr, 0)
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		tmp := strings.Split(entry, ",")
+		if len(tmp) < 2 || len(tmp) > 3 {
+			return nil, fmt.Errorf("%q is not in the correct format", entry)
+		}
+
+		la := listenAddr{network: tmp[0], address: tmp[1], format: DEFAULT_LISTEN_FORMAT}
+		if len(tmp) == 3 && tmp[2] != "" {
+			la.format = tmp[2]
+		}
+
+		switch la.network {
+		case "tcp", "tcp4", "tcp6", "unix", "unixpacket", "udp", "udp4", "udp6", "unixgram", "http", "systemd":
+		default:
+			return nil, fmt.Errorf("%q is not a supported network in %q", la.network, entry)
+		}
+
+		if _, ok := listenFormats[la.format]; !ok {
+			return nil, fmt.Errorf("%q is not a supported format in %q", la.format, entry)
+		}
+
+		addrs = append(addrs, la)
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses given")
+	}
+
+	return addrs, nil
+}
+
+// listenClientMetric describes the measurements clients send, which are
+// theirs to describe rather than shh's.
+var listenClientMetric = MetricDescriptor{"listen.<name>", GaugeType, Empty, "A measurement received from a client, with the type and unit it was sent with", ""}
+
+var listenMetrics = []MetricDescriptor{
+	{"listen.-meta-.metric.count", CounterType, Empty, "Measurements received", "SHH_META=true"},
+	{"listen.-meta-.connection.count", CounterType, Empty, "Connections accepted", "SHH_META=true"},
+	{"listen.-meta-.packet.count", CounterType, Empty, "Datagrams received", "SHH_META=true"},
+	{"listen.-meta-.http.request.count", CounterType, Requests, "HTTP requests received", "SHH_META=true"},
+	{"listen.-meta-.parse.error.count", CounterType, Empty, "Lines that couldn't be parsed", "SHH_META=true"},
+	{"listen.-meta-.connection.active", GaugeType, Connections, "Connections open", "SHH_META=true"},
+	{"listen.-meta-.connection.rejected.count", CounterType, Connections, "Connections closed for exceeding SHH_LISTEN_MAX_CONNECTIONS", "SHH_META=true"},
+	{"listen.-meta-.ratelimit.dropped.count", CounterType, Empty, "Lines dropped for exceeding SHH_LISTEN_RATE_LIMIT", "SHH_META=true"},
+	{"listen.-meta-.names.dropped.count", CounterType, Empty, "Measurements dropped for exceeding SHH_LISTEN_MAX_NAMES", "SHH_META=true"},
+	listenClientMetric,
+}
+
 type Listen struct {
 	measurements chan<- Measurement
-	listener     net.Listener
+	listeners    []net.Listener
+	packetConns  []net.PacketConn
 	Timeout      time.Duration
 	metricCount,
 	connectionCount,
-	parseErrorCount uint64
-	meta      bool
-	closeDown chan struct{}
+	packetCount,
+	httpRequestCount,
+	parseErrorCount,
+	rejectedConnectionCount,
+	rateLimitedCount uint64
+	activeConnections int64
+	maxConnections    int64
+	limiter           *lineLimiter
+	names             *listenNames
+	perms             socketPerms
+	meta              bool
+	flattenInfluxTags bool
+	httpToken         string
+	httpMaxBytes      int64
+	closeDown         chan struct{}
 }
 
-func NewListenPoller(measurements chan<- Measurement, config Config) Listen {
+func NewListenPoller(measurements chan<- Measurement, config Config) *Listen {
 	ctx := slog.Context{"poller": "listen", "fn": "NewListenPoller"}
-	tmp := strings.Split(config.Listen, ",")
 
-	formatErr := fmt.Errorf("SHH_LISTEN is not in the correct format")
-	fix := "The correct format is: <tcp|tcp4|tcp6|unix|unixpacket>,<address>"
+	addrs, err := parseListenAddrs(config.Listen)
+	if err != nil {
+		FatalError(ctx, err, "SHH_LISTEN is not in the correct format. The correct format is a ; separated list of: <tcp|tcp4|tcp6|unix|unixpacket|udp|udp4|udp6|unixgram|http|systemd>,<address>[,<format>]")
+	}
+
+	switch config.ListenInfluxTags {
+	case "", INFLUX_TAGS_KEEP, INFLUX_TAGS_FLATTEN:
+	default:
+		FatalError(ctx, fmt.Errorf("SHH_LISTEN_INFLUX_TAGS is %q", config.ListenInfluxTags), "SHH_LISTEN_INFLUX_TAGS should be one of: keep, flatten")
+	}
 
-	if len(tmp) != 2 {
-		FatalError(ctx, formatErr, fix)
+	perms, err := newSocketPerms(config.ListenSocketMode, config.ListenSocketOwner, config.ListenSocketGroup)
+	if err != nil {
+		FatalError(ctx, err, "SHH_LISTEN_SOCKET_MODE should be octal, and SHH_LISTEN_SOCKET_OWNER and SHH_LISTEN_SOCKET_GROUP existing users and groups")
 	}
 
-	listenNet := tmp[0]
-	listenLaddr := tmp[1]
+	httpMaxBytes := int64(config.ListenHTTPMaxBytes)
+	if httpMaxBytes <= 0 {
+		httpMaxBytes = DEFAULT_LISTEN_HTTP_MAX_BYTES
+	}
 
-	switch listenNet {
-	case "tcp", "tcp4", "tcp6", "unix", "unixpacket":
-		break
-	default:
-		FatalError(ctx, formatErr, fix)
+	poller := &Listen{
+		measurements:      measurements,
+		Timeout:           config.ListenTimeout,
+		closeDown:         make(chan struct{}),
+		meta:              config.Meta,
+		flattenInfluxTags: config.ListenInfluxTags == INFLUX_TAGS_FLATTEN,
+		httpToken:         config.ListenHTTPToken,
+		httpMaxBytes:      httpMaxBytes,
+		maxConnections:    int64(config.ListenMaxConnections),
+		limiter:           newLineLimiter(config.ListenRateLimit),
+		names:             newListenNames(config.ListenMaxNames),
+		perms:             perms,
 	}
 
-	// If this is a path, remove it
-	if listenNet == "unix" && Exists(listenLaddr) {
-		err := os.Remove(listenLaddr)
-		if err != nil {
-			FatalError(ctx, err, "unable to remove old socket path")
+	for _, addr := range addrs {
+		if err := poller.listen(addr); err != nil {
+			FatalError(ctx, err, "unable to listen on "+addr.network+addr.address)
 		}
 	}
 
-	listener, err := net.Listen(listenNet, listenLaddr)
+	return poller
+}
+
+// listen opens addr, or adopts the socket systemd passed for it, and starts
+// serving it.
+func (poller *Listen) listen(addr listenAddr) error {
+	var listener net.Listener
+	var conn net.PacketConn
+	var err error
+
+	format := listenFormats[addr.format]
+
+	if inherited := findInheritedSocket(addr); inherited != nil {
+		listener, conn, err = inherited.adopt()
+	} else if addr.network == "systemd" {
+		return fmt.Errorf("systemd passed no socket named %q", addr.address)
+	} else if addr.datagram() {
+		conn, err = poller.listenPacket(addr)
+	} else {
+		listener, err = poller.listenStream(addr)
+	}
 
 	if err != nil {
-		FatalError(ctx, err, "unable to listen on "+listenNet+listenLaddr)
+		return err
 	}
 
-	poller := Listen{
-		measurements: measurements,
-		listener:     listener,
-		Timeout:      config.ListenTimeout,
-		closeDown:    make(chan struct{}, 1),
-		meta:         config.Meta,
+	if conn != nil {
+		poller.packetConns = append(poller.packetConns, conn)
+		go poller.ReadPackets(conn, format)
+		return nil
 	}
 
-	go poller.Accept()
+	listener = limitedListener{listener, poller}
+	poller.listeners = append(poller.listeners, listener)
 
-	return poller
+	if addr.network == "http" {
+		go poller.ServeHTTP(listener, format)
+	} else {
+		go poller.Accept(listener, format)
+	}
+	return nil
+}
+
+// shuttingDown reports whether Exit has been called
+func (poller *Listen) shuttingDown() bool {
+	select {
+	case <-poller.closeDown:
+		return true
+	default:
+		return false
+	}
 }
 
-func (poller *Listen) Accept() {
-	ctx := slog.Context{"poller": poller.Name(), "fn": "Accept"}
+func (poller *Listen) Accept(listener net.Listener, format listenFormat) {
+	ctx := slog.Context{"poller": poller.Name(), "fn": "Accept", "addr": listener.Addr()}
 	for {
-		conn, err := poller.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
-			select {
-			case <-poller.closeDown:
+			if poller.shuttingDown() {
 				LogError(ctx, err, "shutting down")
 				return
-			default:
-				LogError(ctx, err, "accepting connection")
-				continue
 			}
+			LogError(ctx, err, "accepting connection")
+			continue
 		}
 
-		go poller.HandleListenConnection(conn)
+		go poller.HandleListenConnection(conn, format)
 	}
 }
 
-func (poller Listen) Name() string {
+// ReadPackets reads datagrams from conn, each of which may contain one or
+// more newline separated lines.
+func (poller *Listen) ReadPackets(conn net.PacketConn, format listenFormat) {
+	ctx := slog.Context{"poller": poller.Name(), "fn": "ReadPackets", "addr": conn.LocalAddr()}
+	buf := make([]byte, 65536)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if poller.shuttingDown() {
+				LogError(ctx, err, "shutting down")
+				return
+			}
+			LogError(ctx, err, "reading packet")
+			continue
+		}
+
+		atomic.AddUint64(&poller.packetCount, 1)
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if !poller.allowLine() {
+				continue
+			}
+			if _, err := poller.handleLine(line, format); err != nil && err != errTooManyNames {
+				LogError(ctx, err, "parse error")
+			}
+		}
+	}
+}
+
+func (poller *Listen) Name() string {
 	return "listen"
 }
 
-func (poller Listen) Exit() {
-	poller.closeDown <- struct{}{}
-	poller.listener.Close()
+func (poller *Listen) Exit() {
+	close(poller.closeDown)
+	for _, listener := range poller.listeners {
+		listener.Close()
+	}
+	for _, conn := range poller.packetConns {
+		conn.Close()
+	}
 }
 
-func (poller Listen) Poll(tick time.Time) {
+func (poller *Listen) Poll(tick time.Time) {
 	if poller.meta {
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "metric", "count"}, poller.metricCount, Empty}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "connection", "count"}, poller.connectionCount, Empty}
-		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "parse", "error", "count"}, poller.parseErrorCount, Empty}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "metric", "count"}, atomic.LoadUint64(&poller.metricCount), Empty}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "connection", "count"}, atomic.LoadUint64(&poller.connectionCount), Empty}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "packet", "count"}, atomic.LoadUint64(&poller.packetCount), Empty}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "http", "request", "count"}, atomic.LoadUint64(&poller.httpRequestCount), Requests}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "parse", "error", "count"}, atomic.LoadUint64(&poller.parseErrorCount), Empty}
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"_meta_", "connection", "active"}, uint64(atomic.LoadInt64(&poller.activeConnections)), Connections}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "connection", "rejected", "count"}, atomic.LoadUint64(&poller.rejectedConnectionCount), Connections}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "ratelimit", "dropped", "count"}, atomic.LoadUint64(&poller.rateLimitedCount), Empty}
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{"_meta_", "names", "dropped", "count"}, poller.names.droppedCount(), Empty}
 	}
+
+	// The distinct name cap applies per interval
+	poller.names.reset()
 }
 
-func (poller *Listen) HandleListenConnection(conn net.Conn) {
+func (poller *Listen) HandleListenConnection(conn net.Conn, format listenFormat) {
 	defer conn.Close()
 
 	ctx := slog.Context{"poller": poller.Name(), "fn": "handleListenConnection", "conn": conn}
@@ -152,25 +356,59 @@ func (poller *Listen) HandleListenConnection(conn net.Conn) {
 			break
 		}
 
-		measurement, err := poller.parseLine(line)
-		if err != nil {
-			atomic.AddUint64(&poller.parseErrorCount, 1)
+		if !poller.allowLine() {
+			continue
+		}
+
+		ack, err := poller.handleLine(line, format)
+		if err != nil && err != errTooManyNames {
+			// Skip the bad line, but keep reading the connection
 			LogError(ctx, err, "parse error")
-			break
 		}
 
-		poller.measurements <- measurement
+		if ack {
+			conn.SetWriteDeadline(time.Now().Add(poller.Timeout))
+			if err := writeListenAck(conn, err); err != nil {
+				LogError(ctx, err, "writing ack")
+				break
+			}
+		}
+	}
+}
+
+// handleLine parses line with format and forwards the resulting
+// measurements, reporting whether the client asked for an ack.
+// errTooManyNames is returned if any of them were dropped by the names cap.
+func (poller *Listen) handleLine(line string, format listenFormat) (bool, error) {
+	mms, ack, err := format(poller, line)
+	if err != nil {
+		atomic.AddUint64(&poller.parseErrorCount, 1)
+		return ack, err
+	}
+
+	err = nil
+	for _, mm := range mms {
+		if !poller.names.admit(measurementKey("", mm)) {
+			err = errTooManyNames
+			continue
+		}
+		poller.measurements <- mm
 		atomic.AddUint64(&poller.metricCount, 1)
 	}
+	return ack, err
 }
 
-func (poller Listen) parseLine(line string) (Measurement, error) {
-	var err error
-	var when time.Time
-	var value interface{}
+// parseShhLine parses the original shh line format, described by parseLine
+func (poller *Listen) parseShhLine(line string) ([]Measurement, bool, error) {
+	mm, err := poller.parseLine(line)
+	if err != nil {
+		return nil, false, err
+	}
+	return []Measurement{mm}, false, nil
+}
 
-	mType := "g"
-	unit := Empty
+func (poller *Listen) parseLine(line string) (Measurement, error) {
+	var mType, unit string
 
 	fields := strings.Fields(line)
 	flen := len(fields)
@@ -178,60 +416,76 @@ func (poller Listen) parseLine(line string) (Measurement, error) {
 		return nil, fmt.Errorf("Expected 3, 4 or 5 fields, found %d", len(fields))
 	}
 
-	when, err = poller.parseDate(fields[0])
+	when, err := poller.parseDate(fields[0])
 	if err != nil {
 		return nil, err
 	}
 
-	if !MetricNameRegexp.MatchString(fields[1]) {
-		return nil, fmt.Errorf("%q is an improper metric name", fields[1])
+	if flen >= 4 {
+		mType = fields[3]
 	}
 
-	value, mType, err = poller.parseValue(fields[2])
+	if flen >= 5 {
+		unit = fields[4]
+	}
+
+	return poller.newMeasurement(when, fields[1], fields[2], mType, unit)
+}
+
+// newMeasurement validates the name, value, optional type and optional unit
+// of a measurement received by the listen poller, and builds it.
+func (poller *Listen) newMeasurement(when time.Time, name, vs, t, u string) (Measurement, error) {
+	unit := Empty
+
+	if !MetricNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("%q is an improper metric name", name)
+	}
+
+	value, mType, err := poller.parseValue(vs)
 	if err != nil {
 		return nil, err
 	}
 
-	if flen >= 4 {
-		if fields[3] == "c" || fields[3] == "counter" {
+	if t != "" {
+		if t == "c" || t == "counter" {
 			switch value.(type) {
 			case uint64:
 				mType = "c"
 			default:
 				return nil, fmt.Errorf("value given is incompatible with counter type")
 			}
-		} else if fields[3] == "g" || fields[3] == "gauge" {
+		} else if t == "g" || t == "gauge" {
 			mType = "g"
 		} else {
 			return nil, fmt.Errorf("type specified, but wasn't counter or gauge")
 		}
 	}
 
-	if flen >= 5 {
-		subs := UnitRegexp.FindStringSubmatch(fields[4])
+	if u != "" {
+		subs := UnitRegexp.FindStringSubmatch(u)
 		if len(subs) == 4 {
 			unit = Unit{subs[1], subs[3]}
 		} else {
-			return nil, fmt.Errorf("invalid unit specified in: %q", fields[4])
+			return nil, fmt.Errorf("invalid unit specified in: %q", u)
 		}
 	}
 
 	if mType == "c" {
-		return CounterMeasurement{when, poller.Name(), strings.Fields(fields[1]), value.(uint64), unit}, nil
+		return CounterMeasurement{when, poller.Name(), strings.Fields(name), value.(uint64), unit}, nil
 	}
 
 	switch value.(type) {
 	case float64:
-		return FloatGaugeMeasurement{when, poller.Name(), strings.Fields(fields[1]), value.(float64), unit}, nil
+		return FloatGaugeMeasurement{when, poller.Name(), strings.Fields(name), value.(float64), unit}, nil
 	case uint64:
-		return GaugeMeasurement{when, poller.Name(), strings.Fields(fields[1]), value.(uint64), unit}, nil
+		return GaugeMeasurement{when, poller.Name(), strings.Fields(name), value.(uint64), unit}, nil
 	default:
 		return nil, fmt.Errorf("couldn't create gauge measurement")
 	}
 }
 
 // Parse a string containing either an RFC3339 timestamp or a unix epoch timestamp
-func (poller Listen) parseDate(ds string) (time.Time, error) {
+func (poller *Listen) parseDate(ds string) (time.Time, error) {
 	if when, err := time.Parse(time.RFC3339, ds); err == nil {
 		return when, nil
 	}
@@ -244,7 +498,7 @@ func (poller Listen) parseDate(ds string) (time.Time, error) {
 	}
 }
 
-func (poller Listen) parseValue(vs string) (interface{}, string, error) {
+func (poller *Listen) parseValue(vs string) (interface{}, string, error) {
 	val, err := strconv.ParseUint(vs, 10, 64)
 	if err != nil {
 		fval, err := strconv.ParseFloat(vs, 64)
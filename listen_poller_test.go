@@ -1,6 +1,10 @@
 package shh
 
 import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -104,3 +108,70 @@ func TestListenPollerParser_Errors(t *testing.T) {
 		}
 	}
 }
+
+func TestParseListenAddrs(t *testing.T) {
+	addrs, err := parseListenAddrs("unix,#shh;udp,127.0.0.1:8126;unixgram,/tmp/shh.sock,shh")
+	if err != nil {
+		t.Fatalf("Should have successfully parsed!: got=%s", err)
+	}
+	if len(addrs) != 3 {
+		t.Fatalf("Should have parsed 3 addresses, got=%d", len(addrs))
+	}
+	if addrs[0].network != "unix" || addrs[0].address != "#shh" || addrs[0].format != DEFAULT_LISTEN_FORMAT {
+		t.Errorf("Unexpected first address: %s", addrs[0])
+	}
+	if addrs[0].datagram() {
+		t.Errorf("%s should not be a datagram address", addrs[0])
+	}
+	if !addrs[1].datagram() || !addrs[2].datagram() {
+		t.Errorf("%s and %s should be datagram addresses", addrs[1], addrs[2])
+	}
+
+	failure_cases := []string{
+		"",
+		"unix",
+		"ipx,foo",
+		"tcp,:8000,nope",
+		"tcp,:8000,shh,extra",
+	}
+
+	for _, fail := range failure_cases {
+		if _, err = parseListenAddrs(fail); err == nil {
+			t.Errorf("%q should have failed, but passed instead!", fail)
+		}
+	}
+}
+
+func TestListenPoller_Datagram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "shh.sock")
+	measurements := make(chan Measurement, 2)
+	poller := NewListenPoller(measurements, Config{Listen: "unixgram," + sock, ListenTimeout: time.Second})
+	defer poller.Exit()
+
+	conn, err := net.Dial("unixgram", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("90210 beverly.hills 10\n90210 beverly.hills.mansions 2.5\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"listen.beverly.hills", "listen.beverly.hills.mansions"} {
+		select {
+		case m := <-measurements:
+			if m.Name("") != want {
+				t.Errorf("Expected %s, got=%s", want, m.Name(""))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s", want)
+		}
+	}
+}
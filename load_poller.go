@@ -13,27 +13,37 @@ const (
 	LOAD_DATA = "/proc/loadavg"
 )
 
+var loadMetrics = []MetricDescriptor{
+	pollerErrorMetric("load"),
+	{"load.1m", FloatGaugeType, Avg, "Load average over 1 minute", ""},
+	{"load.5m", FloatGaugeType, Avg, "Load average over 5 minutes", ""},
+	{"load.15m", FloatGaugeType, Avg, "Load average over 15 minutes", ""},
+	{"load.scheduling.entities.executing", GaugeType, Processes, "Runnable processes and threads", ""},
+	{"load.scheduling.entities.total", GaugeType, Processes, "Processes and threads", ""},
+}
+
 type Load struct {
 	measurements chan<- Measurement
+	data         string
 }
 
-func NewLoadPoller(measurements chan<- Measurement) Load {
-	return Load{measurements: measurements}
+func NewLoadPoller(measurements chan<- Measurement, config Config) Load {
+	return Load{measurements: measurements, data: config.procPath(LOAD_DATA)}
 }
 
 func (poller Load) Poll(tick time.Time) {
 	ctx := slog.Context{"poller": poller.Name(), "fn": "Poll", "tick": tick}
 
-	file, err := os.Open(LOAD_DATA)
+	file, err := os.Open(poller.data)
 	if err != nil {
-		FatalError(ctx, err, "opening "+LOAD_DATA)
+		FatalError(ctx, err, "opening "+poller.data)
 	}
 	defer file.Close()
 
 	reader := bufio.NewReader(file)
 	line, err := reader.ReadString('\n')
 	if err != nil {
-		LogError(ctx, err, "reading line from "+LOAD_DATA)
+		LogError(ctx, err, "reading line from "+poller.data)
 		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
 		return
 	}
@@ -12,11 +12,27 @@ var (
 	MEM_MINIMAL_LIST = []string{"memfree", "memtotal", "swapfree", "swaptotal", "buffers", "cached", "swapcached"}
 )
 
+// Fields of /proc/meminfo are lower cased, with _ and ( replaced by .
+var memMetrics = []MetricDescriptor{
+	{"mem.memtotal", GaugeType, Bytes, "Usable memory", ""},
+	{"mem.memfree", GaugeType, Bytes, "Unused memory", ""},
+	{"mem.buffers", GaugeType, Bytes, "Memory used for block device buffers", ""},
+	{"mem.cached", GaugeType, Bytes, "Memory used for the page cache", ""},
+	{"mem.swaptotal", GaugeType, Bytes, "Swap space", ""},
+	{"mem.swapfree", GaugeType, Bytes, "Unused swap space", ""},
+	{"mem.swapcached", GaugeType, Bytes, "Memory swapped out and back in, that is still in swap", ""},
+	{"mem.memtotal.perc", FloatGaugeType, Percent, "Used memory as a percentage of memtotal", "SHH_PERCENTAGES=mem"},
+	{"mem.swaptotal.perc", FloatGaugeType, Percent, "Used swap as a percentage of swaptotal", "SHH_PERCENTAGES=swap"},
+	{"mem.hugepages.<field>", GaugeType, Empty, "A count of huge pages from /proc/meminfo", "SHH_FULL=mem"},
+	{"mem.<field>", GaugeType, Bytes, "Any other field of /proc/meminfo", "SHH_FULL=mem"},
+}
+
 type Memory struct {
 	measurements   chan<- Measurement
 	memPercentage  bool
 	swapPercentage bool
 	full           bool
+	file           string
 }
 
 func NewMemoryPoller(measurements chan<- Measurement, config Config) Memory {
@@ -26,6 +42,7 @@ func NewMemoryPoller(measurements chan<- Measurement, config Config) Memory {
 		measurements:   measurements,
 		memPercentage:  memPerc,
 		swapPercentage: swapPerc,
+		file:           config.procPath(MEMORY_FILE),
 	}
 	mem.full = SliceContainsString(config.Full, mem.Name())
 	return mem
@@ -39,7 +56,7 @@ func (poller Memory) Poll(tick time.Time) {
 	swapTotal := uint64(0)
 	swapFree := uint64(0)
 
-	for line := range FileLineChannel(MEMORY_FILE) {
+	for line := range FileLineChannel(poller.file) {
 		fields := Fields(line)
 		fixed_names := FixUpName(fields[0])
 		value := Atouint64(fields[1])
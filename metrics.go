@@ -0,0 +1,134 @@
+package shh
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MetricDescriptor describes a metric a poller can report
+type MetricDescriptor struct {
+	Name        string // full name, without SHH_PREFIX, with <placeholders> for the parts that vary
+	Type        MeasurementType
+	Unit        Unit
+	Description string
+	EnabledBy   string // setting that has to be given for the metric to be reported, if any
+}
+
+// PollerMetrics are the metrics each poller can report, keyed by the name
+// used in SHH_POLLERS. Within a poller, more specific names come before the
+// placeholders that would also match them.
+var PollerMetrics = map[string][]MetricDescriptor{
+	"cgroup":            cgroupMetrics,
+	"conntrack":         conntrackMetrics,
+	"containers":        containersMetrics,
+	"cpu":               cpuMetrics,
+	"df":                dfMetrics,
+	"disk":              diskMetrics,
+	"filenr":            filenrMetrics,
+	"folsom":            folsomMetrics,
+	"listen":            listenMetrics,
+	"load":              loadMetrics,
+	"mem":               memMetrics,
+	"nagios3stats":      nagios3statsMetrics,
+	"netstat":           netstatMetrics,
+	"nif":               nifMetrics,
+	"ntpdate":           ntpdateMetrics,
+	"pressure":          pressureMetrics,
+	"processes":         processesMetrics,
+	"redis":             redisMetrics(),
+	"self":              selfMetrics,
+	"sockstat":          sockstatMetrics,
+	"splunksearchpeers": splunkSearchPeersMetrics,
+	"syslogngstats":     syslogngStatsMetrics,
+	"tcp":               tcpMetrics,
+	"vmstat":            vmstatMetrics,
+}
+
+// MultiMetrics are reported for all pollers, rather than by any one of them
+var MultiMetrics = []MetricDescriptor{
+	{"multi-poller.duration.all.seconds", FloatGaugeType, Seconds, "Time taken to poll all pollers", "SHH_META=true"},
+	{"multi-poller.duration.<poller>.seconds", FloatGaugeType, Seconds, "Time taken to poll each poller", "SHH_META=true"},
+}
+
+// pollerErrorMetric describes the measurement a poller reports when it
+// fails to collect its metrics.
+func pollerErrorMetric(poller string) MetricDescriptor {
+	return MetricDescriptor{poller + ".error", GaugeType, Errors, "1 when the poller failed to collect its metrics", ""}
+}
+
+var (
+	metricPatternsOnce sync.Once
+	metricPatterns     map[string]*regexp.Regexp
+	placeholderRegexp  = regexp.MustCompile(`<[^>]+>`)
+)
+
+// pattern returns the regexp matching the names md describes
+func (md MetricDescriptor) pattern() *regexp.Regexp {
+	metricPatternsOnce.Do(func() {
+		metricPatterns = make(map[string]*regexp.Regexp)
+		for _, mds := range append(SortedPollerMetrics(), MultiMetrics) {
+			for _, md := range mds {
+				parts := placeholderRegexp.Split(md.Name, -1)
+				for i := range parts {
+					parts[i] = regexp.QuoteMeta(parts[i])
+				}
+				metricPatterns[md.Name] = regexp.MustCompile("^" + strings.Join(parts, ".+") + "$")
+			}
+		}
+	})
+	return metricPatterns[md.Name]
+}
+
+// SortedPollerMetrics returns the descriptors in PollerMetrics, ordered by
+// poller name.
+func SortedPollerMetrics() [][]MetricDescriptor {
+	pollers := make([]string, 0, len(PollerMetrics))
+	for poller := range PollerMetrics {
+		pollers = append(pollers, poller)
+	}
+	sort.Strings(pollers)
+
+	mds := make([][]MetricDescriptor, len(pollers))
+	for i, poller := range pollers {
+		mds[i] = PollerMetrics[poller]
+	}
+	return mds
+}
+
+// DescribeMeasurement returns the descriptor for mm, for use as help text by
+// outputters. When several descriptors match its name, the first with the
+// same type as mm is preferred.
+func DescribeMeasurement(mm Measurement) (MetricDescriptor, bool) {
+	name := mm.Name("")
+
+	var found MetricDescriptor
+	ok := false
+	for _, mds := range append(SortedPollerMetrics(), MultiMetrics) {
+		for _, md := range mds {
+			if md.pattern() == nil || !md.pattern().MatchString(name) {
+				continue
+			}
+			if md.Type == mm.Type() {
+				return md, true
+			}
+			if !ok {
+				found, ok = md, true
+			}
+		}
+	}
+	return found, ok
+}
+
+func (t MeasurementType) String() string {
+	switch t {
+	case CounterType:
+		return "counter"
+	case GaugeType:
+		return "gauge"
+	case FloatGaugeType:
+		return "float gauge"
+	}
+	return "unknown"
+}
@@ -0,0 +1,94 @@
+package shh
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPollerMetrics_CoverKnownPollers(t *testing.T) {
+	for _, poller := range KnownPollers {
+		if len(PollerMetrics[poller]) == 0 {
+			t.Errorf("Should have metric descriptors for the %s poller", poller)
+		}
+	}
+
+	for poller := range PollerMetrics {
+		if !SliceContainsString(KnownPollers, poller) {
+			t.Errorf("Should not have metric descriptors for unknown poller %s", poller)
+		}
+	}
+}
+
+func TestPollerMetrics_ValidNames(t *testing.T) {
+	placeholders := regexp.MustCompile(`<[a-z-]+>`)
+
+	for _, mds := range append(SortedPollerMetrics(), MultiMetrics) {
+		for _, md := range mds {
+			name := placeholders.ReplaceAllString(md.Name, "x")
+			if !MetricNameRegexp.MatchString(name) {
+				t.Errorf("Should have a valid metric name, got %q", md.Name)
+			}
+			if md.Description == "" {
+				t.Errorf("Should have a description for %q", md.Name)
+			}
+		}
+	}
+}
+
+func TestDescribeMeasurement(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		mm       Measurement
+		expected string
+	}{
+		{FloatGaugeMeasurement{now, "cpu", []string{"cpu0", "user"}, 1, Percent}, "cpu.<cpu>.user"},
+		{GaugeMeasurement{now, "mem", []string{"hugepages", "total"}, 1, Empty}, "mem.hugepages.<field>"},
+		{GaugeMeasurement{now, "mem", []string{"active", "anon"}, 1, Bytes}, "mem.<field>"},
+		{GaugeMeasurement{now, "mem", []string{"memfree"}, 1, Bytes}, "mem.memfree"},
+		{GaugeMeasurement{now, "redis", []string{"memory", "used_memory"}, 1, Empty}, "redis.memory.used-memory"},
+		{CounterMeasurement{now, "redis", []string{"stats", "total_commands_processed"}, 1, Empty}, "redis.<section>.<key>"},
+		{FloatGaugeMeasurement{now, "multi_poller", []string{"duration", "cpu", "seconds"}, 1, Seconds}, "multi-poller.duration.<poller>.seconds"},
+	}
+
+	for _, c := range cases {
+		md, ok := DescribeMeasurement(c.mm)
+		if !ok || md.Name != c.expected {
+			t.Errorf("Should have described %s as %s, got %s", c.mm.Name(""), c.expected, md.Name)
+		}
+	}
+
+	if md, ok := DescribeMeasurement(GaugeMeasurement{now, "folsom", []string{"requests"}, 1, Empty}); !ok || md.Type != GaugeType {
+		t.Errorf("Should have preferred the descriptor matching the measurement's type, got %v", md.Type)
+	}
+
+	if _, ok := DescribeMeasurement(GaugeMeasurement{now, "nope", []string{"x"}, 1, Empty}); ok {
+		t.Errorf("Should not have described a measurement from an unknown poller")
+	}
+}
+
+// The measurements of the pollers that only read from /proc should all be
+// described, with the right type and unit.
+func TestPollerMetrics_MatchMeasurements(t *testing.T) {
+	config := Config{
+		Pollers:          []string{"cpu", "filenr", "load", "mem", "self", "sockstat"},
+		Full:             []string{"mem", "self"},
+		Percentages:      []string{"mem", "swap"},
+		SockStatProtos:   []string{"TCP", "UDP"},
+		CpuOnlyAggregate: false,
+		Meta:             true,
+	}
+
+	mms, _ := CollectOnce(config, 10*time.Millisecond)
+	for _, mm := range mms {
+		md, ok := DescribeMeasurement(mm)
+		if !ok {
+			t.Errorf("Should have described %s", mm.Name(""))
+			continue
+		}
+		if md.Type != mm.Type() || md.Unit != mm.Unit() {
+			t.Errorf("Should have described %s as a %s in %q, got a %s in %q", mm.Name(""), mm.Type(), mm.Unit().Name(), md.Type, md.Unit.Name())
+		}
+	}
+}
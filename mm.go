@@ -2,6 +2,7 @@ package shh
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -144,6 +145,64 @@ func (c FloatGaugeMeasurement) Unit() Unit {
 	return c.unit
 }
 
+// TaggedMeasurement decorates a Measurement with a source and tags of its
+// own, such as those given to the listen poller by external clients.
+type TaggedMeasurement struct {
+	Measurement
+	source string
+	tags   map[string]string
+}
+
+func (t TaggedMeasurement) Source() string {
+	return t.source
+}
+
+func (t TaggedMeasurement) Tags() map[string]string {
+	return t.tags
+}
+
+// SortedTagKeys returns the tag keys in a stable order
+func (t TaggedMeasurement) SortedTagKeys() []string {
+	keys := make([]string, 0, len(t.tags))
+	for k := range t.tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Untagged returns the measurement underlying mm, stripping any
+// TaggedMeasurement wrapper.
+func Untagged(mm Measurement) Measurement {
+	if t, ok := mm.(TaggedMeasurement); ok {
+		return t.Measurement
+	}
+	return mm
+}
+
+// Retagged returns replacement decorated with the same source and tags as
+// mm, if it had any.
+func Retagged(mm Measurement, replacement Measurement) Measurement {
+	if t, ok := mm.(TaggedMeasurement); ok {
+		t.Measurement = replacement
+		return t
+	}
+	return replacement
+}
+
+// measurementKey identifies the series mm belongs to, which includes its
+// source and tags if it has any.
+func measurementKey(prefix string, mm Measurement) string {
+	key := mm.Name(prefix)
+	if t, ok := mm.(TaggedMeasurement); ok {
+		key += " source=" + t.source
+		for _, k := range t.SortedTagKeys() {
+			key += " " + k + "=" + t.tags[k]
+		}
+	}
+	return key
+}
+
 // func (m Measurement) Timestamp() string {
 // 	return m.When.Format(time.RFC3339)
 // }
@@ -10,6 +10,11 @@ import (
 	"github.com/heroku/slog"
 )
 
+var nagios3statsMetrics = []MetricDescriptor{
+	pollerErrorMetric("nagios3stats"),
+	{"nagios3stats.<metric>", GaugeType, Empty, "Each of SHH_NAGIOS3_METRIC_NAMES, lower cased", ""},
+}
+
 type Nagios3StatsPoller struct {
 	measurements chan<- Measurement
 	metricNames  []string
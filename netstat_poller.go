@@ -0,0 +1,145 @@
+package shh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heroku/slog"
+)
+
+const (
+	SNMP_DATA    = "/proc/net/snmp"
+	NETSTAT_DATA = "/proc/net/netstat"
+)
+
+var (
+	NETSTAT_MINIMAL_LIST = map[string][]string{
+		"Ip":     {"InReceives", "InHdrErrors", "InAddrErrors", "InDiscards", "OutRequests", "OutDiscards", "OutNoRoutes"},
+		"Tcp":    {"ActiveOpens", "PassiveOpens", "CurrEstab", "RetransSegs", "InErrs", "OutRsts"},
+		"TcpExt": {"ListenOverflows", "ListenDrops", "TCPTimeouts", "SyncookiesSent"},
+		"Udp":    {"InDatagrams", "OutDatagrams", "NoPorts", "InErrors", "RcvbufErrors", "SndbufErrors"},
+	}
+)
+
+// Fields that are settings rather than counters, and never reported
+var netstatSettings = map[string][]string{
+	"Ip":  {"Forwarding", "DefaultTTL"},
+	"Tcp": {"RtoAlgorithm", "RtoMin", "RtoMax", "MaxConn"},
+}
+
+// Protocols and fields are lower cased
+var netstatMetrics = []MetricDescriptor{
+	pollerErrorMetric("netstat"),
+	{"netstat.ip.inreceives", CounterType, Packets, "IP datagrams received", ""},
+	{"netstat.ip.inhdrerrors", CounterType, Packets, "IP datagrams discarded for header errors", ""},
+	{"netstat.ip.inaddrerrors", CounterType, Packets, "IP datagrams discarded for an invalid destination address", ""},
+	{"netstat.ip.indiscards", CounterType, Packets, "IP datagrams received and discarded for lack of buffer space", ""},
+	{"netstat.ip.outrequests", CounterType, Packets, "IP datagrams sent", ""},
+	{"netstat.ip.outdiscards", CounterType, Packets, "IP datagrams to send discarded for lack of buffer space", ""},
+	{"netstat.ip.outnoroutes", CounterType, Packets, "IP datagrams discarded for want of a route", ""},
+	{"netstat.tcp.activeopens", CounterType, Connections, "TCP connections opened", ""},
+	{"netstat.tcp.passiveopens", CounterType, Connections, "TCP connections accepted", ""},
+	{"netstat.tcp.currestab", GaugeType, Connections, "TCP connections in ESTABLISHED or CLOSE_WAIT", ""},
+	{"netstat.tcp.retranssegs", CounterType, Packets, "TCP segments retransmitted", ""},
+	{"netstat.tcp.inerrs", CounterType, Packets, "TCP segments received in error", ""},
+	{"netstat.tcp.outrsts", CounterType, Packets, "TCP segments sent with RST set", ""},
+	{"netstat.tcpext.listenoverflows", CounterType, Connections, "Connections dropped because a listen queue was full", ""},
+	{"netstat.tcpext.listendrops", CounterType, Connections, "Connections dropped by a listening socket, for any reason", ""},
+	{"netstat.tcpext.tcptimeouts", CounterType, Empty, "TCP retransmission timeouts", ""},
+	{"netstat.tcpext.syncookiessent", CounterType, Empty, "SYN cookies sent, when the SYN queue was full", ""},
+	{"netstat.udp.indatagrams", CounterType, Packets, "UDP datagrams received", ""},
+	{"netstat.udp.outdatagrams", CounterType, Packets, "UDP datagrams sent", ""},
+	{"netstat.udp.noports", CounterType, Packets, "UDP datagrams received for a port nothing listens on", ""},
+	{"netstat.udp.inerrors", CounterType, Packets, "UDP datagrams received in error", ""},
+	{"netstat.udp.rcvbuferrors", CounterType, Packets, "UDP datagrams dropped because a receive buffer was full", ""},
+	{"netstat.udp.sndbuferrors", CounterType, Packets, "UDP datagrams dropped because a send buffer was full", ""},
+	{"netstat.<proto>.<field>", CounterType, Empty, "Any other field of /proc/net/snmp or /proc/net/netstat", "SHH_FULL=netstat"},
+}
+
+type Netstat struct {
+	measurements chan<- Measurement
+	full         bool
+	files        []string
+}
+
+func NewNetstatPoller(measurements chan<- Measurement, config Config) Netstat {
+	poller := Netstat{
+		measurements: measurements,
+		files:        []string{config.procNetPath(SNMP_DATA), config.procNetPath(NETSTAT_DATA)},
+	}
+	poller.full = SliceContainsString(config.Full, poller.Name())
+	return poller
+}
+
+// Both files hold pairs of lines per protocol, the first naming the fields
+// and the second holding their values, like "Tcp: RtoAlgorithm RtoMin ..."
+// followed by "Tcp: 1 200 ...".
+// https://www.kernel.org/doc/Documentation/networking/snmp_counter.rst
+func (poller Netstat) Poll(tick time.Time) {
+	ctx := slog.Context{"poller": poller.Name(), "fn": "Poll", "tick": tick}
+
+	for _, file := range poller.files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			LogError(ctx, err, "reading "+file)
+			poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
+			continue
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		for i := 0; i+1 < len(lines); i += 2 {
+			names := strings.Fields(lines[i])
+			values := strings.Fields(lines[i+1])
+			if len(names) == 0 || len(names) != len(values) || names[0] != values[0] {
+				LogError(ctx, fmt.Errorf("mismatched lines %q and %q", names, values), "parsing "+file)
+				poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
+				break
+			}
+
+			poller.report(tick, strings.TrimSuffix(names[0], ":"), names[1:], values[1:])
+		}
+	}
+}
+
+func (poller Netstat) report(tick time.Time, proto string, names, values []string) {
+	for i, field := range names {
+		if SliceContainsString(netstatSettings[proto], field) {
+			continue
+		}
+		if !poller.full && !SliceContainsString(NETSTAT_MINIMAL_LIST[proto], field) {
+			continue
+		}
+
+		value, err := strconv.ParseUint(values[i], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		what := []string{strings.ToLower(proto), strings.ToLower(field)}
+		if proto == "Tcp" && field == "CurrEstab" {
+			poller.measurements <- GaugeMeasurement{tick, poller.Name(), what, value, Connections}
+		} else {
+			poller.measurements <- CounterMeasurement{tick, poller.Name(), what, value, netstatUnit(what)}
+		}
+	}
+}
+
+// netstatUnit is the unit of the minimal metrics, as described
+func netstatUnit(what []string) Unit {
+	name := "netstat." + strings.Join(what, ".")
+	for _, md := range netstatMetrics {
+		if md.Name == name {
+			return md.Unit
+		}
+	}
+	return Empty
+}
+
+func (poller Netstat) Name() string {
+	return "netstat"
+}
+
+func (poller Netstat) Exit() {}
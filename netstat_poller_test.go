@@ -0,0 +1,76 @@
+package shh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNetstatPoller(t *testing.T) {
+	root := newFixture(t, map[string]string{
+		"proc/1/net/snmp": "Ip: Forwarding DefaultTTL InReceives InDiscards\nIp: 2 64 100 1\n" +
+			"Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens CurrEstab RetransSegs InSegs\nTcp: 1 200 120000 -1 5 3 7 900\n" +
+			"Udp: InDatagrams InErrors RcvbufErrors\nUdp: 10 2 1\n",
+		"proc/1/net/netstat": "TcpExt: SyncookiesSent ListenOverflows ListenDrops TW\nTcpExt: 4 8 9 11\n" +
+			"IpExt: InOctets\nIpExt: 1234\n",
+		// our own network namespace, rather than that of the root's init
+		"proc/net/snmp": "Ip: InReceives\nIp: 999\n",
+	})
+
+	config := Config{ProcRoot: root + "/proc"}
+	values := pollValues(t, func(measurements chan<- Measurement) {
+		NewNetstatPoller(measurements, config).Poll(time.Now())
+	})
+	expected := map[string]string{
+		"netstat.ip.inreceives":          "100",
+		"netstat.ip.indiscards":          "1",
+		"netstat.tcp.activeopens":        "5",
+		"netstat.tcp.currestab":          "3",
+		"netstat.tcp.retranssegs":        "7",
+		"netstat.udp.indatagrams":        "10",
+		"netstat.udp.inerrors":           "2",
+		"netstat.udp.rcvbuferrors":       "1",
+		"netstat.tcpext.syncookiessent":  "4",
+		"netstat.tcpext.listenoverflows": "8",
+		"netstat.tcpext.listendrops":     "9",
+	}
+	if len(values) != len(expected) {
+		t.Errorf("Should have reported %d metrics, got %v", len(expected), values)
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+
+	config.Full = []string{"netstat"}
+	values = pollValues(t, func(measurements chan<- Measurement) {
+		NewNetstatPoller(measurements, config).Poll(time.Now())
+	})
+	expected = map[string]string{
+		"netstat.tcp.insegs":      "900",
+		"netstat.tcpext.tw":       "11",
+		"netstat.ipext.inoctets":  "1234",
+		"netstat.tcp.retranssegs": "7",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+	for _, name := range []string{"netstat.ip.forwarding", "netstat.tcp.maxconn", "netstat.error"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("Should not have reported %s", name)
+		}
+	}
+}
+
+func TestNetstatPoller_Mismatched(t *testing.T) {
+	root := newFixture(t, map[string]string{
+		"proc/1/net/snmp":    "Tcp: ActiveOpens RetransSegs\nTcp: 5\n",
+		"proc/1/net/netstat": "",
+	})
+
+	checkPollError(t, "netstat", func(measurements chan<- Measurement) {
+		NewNetstatPoller(measurements, Config{ProcRoot: root + "/proc"}).Poll(time.Now())
+	})
+}
@@ -1,33 +1,106 @@
 package shh
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/heroku/slog"
 )
 
 const (
-	DEVICE_FILE = "/proc/net/dev"
+	DEVICE_FILE  = "/proc/net/dev"
+	NIF_SYS      = "/sys/class/net"
+	IFF_LOOPBACK = 0x8 // from linux/if.h
 )
 
+var nifMetrics = []MetricDescriptor{
+	{"nif.<device>.receive.bytes", CounterType, Bytes, "Bytes received", ""},
+	{"nif.<device>.receive.packets", CounterType, Packets, "Packets received", ""},
+	{"nif.<device>.receive.errors", CounterType, Errors, "Receive errors", ""},
+	{"nif.<device>.receive.dropped", CounterType, Empty, "Received packets dropped", ""},
+	{"nif.<device>.receive.errors.fifo", CounterType, Errors, "Receive FIFO buffer errors", ""},
+	{"nif.<device>.receive.errors.frame", CounterType, Errors, "Receive framing errors", ""},
+	{"nif.<device>.receive.compressed", CounterType, Empty, "Compressed packets received", ""},
+	{"nif.<device>.receive.multicast", CounterType, Empty, "Multicast frames received", ""},
+	{"nif.<device>.receive.utilization", FloatGaugeType, Percent, "Bytes received since the last poll, as a percentage of the link speed", ""},
+	{"nif.<device>.transmit.bytes", CounterType, Bytes, "Bytes transmitted", ""},
+	{"nif.<device>.transmit.packets", CounterType, Packets, "Packets transmitted", ""},
+	{"nif.<device>.transmit.errors", CounterType, Errors, "Transmit errors", ""},
+	{"nif.<device>.transmit.dropped", CounterType, Empty, "Transmitted packets dropped", ""},
+	{"nif.<device>.transmit.errors.fifo", CounterType, Errors, "Transmit FIFO buffer errors", ""},
+	{"nif.<device>.transmit.errors.collisions", CounterType, Errors, "Collisions", ""},
+	{"nif.<device>.transmit.errors.carrier", CounterType, Errors, "Carrier losses", ""},
+	{"nif.<device>.transmit.compressed", CounterType, Empty, "Compressed packets transmitted", ""},
+	{"nif.<device>.transmit.utilization", FloatGaugeType, Percent, "Bytes transmitted since the last poll, as a percentage of the link speed", ""},
+	{"nif.<device>.up", GaugeType, Empty, "1 when the interface's operational state is up, 0 otherwise", ""},
+	{"nif.<device>.speed", GaugeType, Mbps, "Link speed, for interfaces that have one", ""},
+	{"nif.<device>.mtu", GaugeType, Bytes, "Maximum transmission unit", ""},
+	{"nif.<device>.carrier.changes", CounterType, Empty, "Times the link went up or down", ""},
+}
+
+// nifSample is the byte counters of a device at a poll, to work out
+// utilization from at the next one
+type nifSample struct {
+	receive, transmit uint64
+	tick              time.Time
+}
+
 type NetworkInterface struct {
 	measurements chan<- Measurement
-	Devices      []string
+	Devices      []string // exact names
+	globs        []string
+	regexps      []*regexp.Regexp
+	discover     bool
+	file         string
+	sys          string
+	last         map[string]nifSample
 }
 
 func NewNetworkInterfacePoller(measurements chan<- Measurement, config Config) NetworkInterface {
-	return NetworkInterface{
+	poller := NetworkInterface{
 		measurements: measurements,
-		Devices:      config.NifDevices,
+		discover:     config.NifDiscover,
+		file:         config.procNetPath(DEVICE_FILE),
+		sys:          config.sysPath(NIF_SYS),
+		last:         make(map[string]nifSample),
 	}
+
+	for _, device := range config.NifDevices {
+		switch {
+		case strings.HasPrefix(device, REGEXP_PREFIX):
+			re, err := compilePatternRegexp(device)
+			if err != nil {
+				LogError(slog.Context{"poller": poller.Name(), "fn": "NewNetworkInterfacePoller", "device": device}, err, "compiling regexp")
+				continue
+			}
+			poller.regexps = append(poller.regexps, re)
+		case isGlob(device):
+			poller.globs = append(poller.globs, device)
+		default:
+			poller.Devices = append(poller.Devices, device)
+		}
+	}
+
+	return poller
 }
 
 // http://www.kernel.org/doc/Documentation/filesystems/proc.txt (section 1.4)
 func (poller NetworkInterface) Poll(tick time.Time) {
+	seen := make(map[string]bool)
 
-	for line := range FileLineChannel(DEVICE_FILE) {
+	for line := range FileLineChannel(poller.file) {
+		// skip the headers, only lines for devices have a :
+		if !strings.Contains(line, ":") {
+			continue
+		}
 		fields := Fields(line)
 		device := fields[0]
 
-		if SliceContainsString(poller.Devices, device) {
+		if poller.matches(device) {
 			// It's a device we want to gather metrics for
 
 			poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "receive", "bytes"}, Atouint64(fields[1]), Bytes}
@@ -48,7 +121,96 @@ func (poller NetworkInterface) Poll(tick time.Time) {
 			poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "transmit", "errors", "carrier"}, Atouint64(fields[15]), Errors}
 			poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "transmit", "compressed"}, Atouint64(fields[16]), Empty}
 
+			seen[device] = true
+			sample := nifSample{receive: Atouint64(fields[1]), transmit: Atouint64(fields[9]), tick: tick}
+			poller.handleLink(tick, device, sample)
+		}
+	}
+
+	for device := range poller.last {
+		if !seen[device] {
+			delete(poller.last, device)
+		}
+	}
+}
+
+// matches reports whether device is one to gather metrics for
+func (poller NetworkInterface) matches(device string) bool {
+	if SliceContainsString(poller.Devices, device) {
+		return true
+	}
+	for _, glob := range poller.globs {
+		if ok, _ := filepath.Match(glob, device); ok {
+			return true
+		}
+	}
+	for _, re := range poller.regexps {
+		if re.MatchString(device) {
+			return true
+		}
+	}
+	return poller.discover && !poller.loopback(device)
+}
+
+// loopback reports whether device is a loopback interface, going by its
+// flags, or by its name if they can't be read.
+func (poller NetworkInterface) loopback(device string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(poller.sys, device, "flags"))
+	if err != nil {
+		return device == "lo"
+	}
+	flags, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"), 16, 64)
+	return err != nil || flags&IFF_LOOPBACK != 0
+}
+
+// handleLink reports the attributes of device's link, from sysfs, and the
+// utilization of it since the last poll. Attributes that can't be read,
+// like the speed of virtual interfaces or of ones that are down, are
+// skipped.
+// https://www.kernel.org/doc/Documentation/ABI/testing/sysfs-class-net
+func (poller NetworkInterface) handleLink(tick time.Time, device string, sample nifSample) {
+	dir := filepath.Join(poller.sys, device)
+
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "operstate")); err == nil {
+		up := uint64(0)
+		if strings.TrimSpace(string(data)) == "up" {
+			up = 1
 		}
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{device, "up"}, up, Empty}
+	}
+
+	if mtu, err := readUint64(filepath.Join(dir, "mtu")); err == nil {
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{device, "mtu"}, mtu, Bytes}
+	}
+
+	if changes, err := readUint64(filepath.Join(dir, "carrier_changes")); err == nil {
+		poller.measurements <- CounterMeasurement{tick, poller.Name(), []string{device, "carrier", "changes"}, changes, Empty}
+	}
+
+	last, exists := poller.last[device]
+	poller.last[device] = sample
+
+	// speed is -1, or can't be read at all, when unknown
+	data, err := ioutil.ReadFile(filepath.Join(dir, "speed"))
+	if err != nil {
+		return
+	}
+	speed, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || speed <= 0 {
+		return
+	}
+	poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{device, "speed"}, uint64(speed), Mbps}
+
+	elapsed := sample.tick.Sub(last.tick).Seconds()
+	if !exists || elapsed <= 0 {
+		return
+	}
+	capacity := elapsed * float64(speed) * 1000 * 1000 / 8 // in bytes
+	if sample.receive >= last.receive {
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{device, "receive", "utilization"}, float64(sample.receive-last.receive) * 100 / capacity, Percent}
+	}
+	if sample.transmit >= last.transmit {
+		poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), []string{device, "transmit", "utilization"}, float64(sample.transmit-last.transmit) * 100 / capacity, Percent}
 	}
 }
 
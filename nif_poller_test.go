@@ -0,0 +1,85 @@
+package shh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNetworkInterfacePoller(t *testing.T) {
+	header := "Inter-|   Receive                                                |  Transmit\n" +
+		" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n"
+	dev := func(ens5Receive, ens5Transmit string) string {
+		return header +
+			"    lo: 1000 10 0 0 0 0 0 0 1000 10 0 0 0 0 0 0\n" +
+			"  ens5: " + ens5Receive + " 100 0 0 0 0 0 0 " + ens5Transmit + " 200 0 0 0 0 0 0\n" +
+			"veth1a2b: 300 3 0 0 0 0 0 0 400 4 0 0 0 0 0 0\n" +
+			"  eth0.100: 500 5 0 0 0 0 0 0 600 6 0 0 0 0 0 0\n"
+	}
+	root := newFixture(t, map[string]string{
+		"proc/1/net/dev":                         dev("1000000", "2000000"),
+		"sys/class/net/lo/flags":                 "0x9\n",
+		"sys/class/net/lo/operstate":             "unknown\n",
+		"sys/class/net/ens5/flags":               "0x1003\n",
+		"sys/class/net/ens5/operstate":           "up\n",
+		"sys/class/net/ens5/speed":               "100\n",
+		"sys/class/net/ens5/mtu":                 "9001\n",
+		"sys/class/net/ens5/carrier_changes":     "2\n",
+		"sys/class/net/veth1a2b/flags":           "0x1003\n",
+		"sys/class/net/veth1a2b/operstate":       "down\n",
+		"sys/class/net/veth1a2b/speed":           "-1\n",
+		"sys/class/net/veth1a2b/mtu":             "1500\n",
+		"sys/class/net/veth1a2b/carrier_changes": "0\n",
+	})
+
+	poll := func(poller NetworkInterface, tick time.Time) map[string]string {
+		return pollValues(t, func(measurements chan<- Measurement) {
+			poller.measurements = measurements
+			poller.Poll(tick)
+		})
+	}
+
+	config := Config{ProcRoot: root + "/proc", SysRoot: root + "/sys", NifDevices: []string{"en*", "re:eth0\\.[0-9]+"}}
+	poller := NewNetworkInterfacePoller(nil, config)
+	tick := time.Now()
+	values := poll(poller, tick)
+
+	expected := map[string]string{
+		"nif.ens5.receive.bytes":     "1000000",
+		"nif.ens5.up":                "1",
+		"nif.ens5.speed":             "100",
+		"nif.ens5.mtu":               "9001",
+		"nif.ens5.carrier.changes":   "2",
+		"nif.eth0.100.receive.bytes": "500",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+	for _, name := range []string{"nif.lo.receive.bytes", "nif.veth1a2b.receive.bytes", "nif.ens5.receive.utilization"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("Should not have reported %s", name)
+		}
+	}
+
+	// 10s at 100Mbps is 125MB
+	writeFixture(t, root, map[string]string{"proc/1/net/dev": dev("13500000", "2000000")})
+	values = poll(poller, tick.Add(10*time.Second))
+	if values["nif.ens5.receive.utilization"] != "10.000000" || values["nif.ens5.transmit.utilization"] != "0.000000" {
+		t.Errorf("Should have reported utilization, got %q and %q", values["nif.ens5.receive.utilization"], values["nif.ens5.transmit.utilization"])
+	}
+
+	config.NifDevices = nil
+	config.NifDiscover = true
+	values = poll(NewNetworkInterfacePoller(nil, config), tick)
+	for _, name := range []string{"nif.ens5.receive.bytes", "nif.veth1a2b.receive.bytes", "nif.veth1a2b.up", "nif.veth1a2b.mtu"} {
+		if _, ok := values[name]; !ok {
+			t.Errorf("Should have discovered %s", name)
+		}
+	}
+	for _, name := range []string{"nif.lo.receive.bytes", "nif.veth1a2b.speed", "nif.face.receive.bytes"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("Should not have reported %s", name)
+		}
+	}
+}
@@ -10,6 +10,13 @@ import (
 	"github.com/heroku/slog"
 )
 
+// Servers are named with their first four . replaced by -
+var ntpdateMetrics = []MetricDescriptor{
+	pollerErrorMetric("ntpdate"),
+	{"ntpdate.offset.<server>", FloatGaugeType, Seconds, "Clock offset from the server", ""},
+	{"ntpdate.delay.<server>", FloatGaugeType, Seconds, "Round trip delay to the server", ""},
+}
+
 type Ntpdate struct {
 	measurements chan<- Measurement
 	Servers      []string
@@ -0,0 +1,209 @@
+package shh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heroku/slog"
+)
+
+const (
+	DEFAULT_ONCE_DELAY  = time.Second // Delay between the two samples taken by -once
+	DEFAULT_ONCE_FORMAT = "text"      // Format -once prints measurements in
+)
+
+// OnceFormats are the formats WriteMeasurements supports
+var OnceFormats = []string{"text", "l2met", "json"}
+
+// CollectOnce runs the configured pollers twice, delay apart, and returns
+// the measurements from the second poll, sorted by name, along with the
+// names of the pollers that logged an error during either. Two samples are
+// taken so that pollers which report rates, like cpu, have something to
+// compare against. The listen poller is skipped, as there's nothing to
+// listen for and it would take over the socket of a running shh.
+func CollectOnce(config Config, delay time.Duration) ([]Measurement, []string) {
+	pollers := make([]string, 0, len(config.Pollers))
+	for _, poller := range config.Pollers {
+		if poller != "listen" {
+			pollers = append(pollers, poller)
+		}
+	}
+	config.Pollers = pollers
+
+	measurements := make(chan Measurement, 100)
+	collected := make(chan []Measurement)
+	go func() {
+		mms := make([]Measurement, 0)
+		for mm := range measurements {
+			mms = append(mms, mm)
+		}
+		collected <- mms
+	}()
+
+	failures.start()
+	mp := NewMultiPoller(measurements, config)
+	mp.Poll(time.Now())
+	time.Sleep(delay)
+	second := time.Now()
+	mp.Poll(second)
+	mp.Exit()
+	failed := failures.stop()
+	close(measurements)
+
+	mms := make([]Measurement, 0)
+	for _, mm := range <-collected {
+		if mm.Time().Equal(second) {
+			mms = append(mms, mm)
+		}
+	}
+
+	sort.SliceStable(mms, func(i, j int) bool {
+		return measurementKey("", mms[i]) < measurementKey("", mms[j])
+	})
+	return mms, failed
+}
+
+// pollFailures collects, by poller name, the errors logged through LogError
+// and FatalError while CollectOnce runs, so -once can tell which pollers
+// failed whether or not they also report an error measurement. Errors
+// logged outside of any poller are collected by function name.
+type pollFailures struct {
+	sync.Mutex
+	collecting bool
+	pollers    map[string]error
+}
+
+var failures pollFailures
+
+// errStopped is recorded for a poller stopped by FatalError
+var errStopped = errors.New("stopped by a fatal error")
+
+func (pf *pollFailures) start() {
+	pf.Lock()
+	defer pf.Unlock()
+	pf.collecting = true
+	pf.pollers = make(map[string]error)
+}
+
+// stop ends the collection, returning the sorted names of the pollers that
+// failed.
+func (pf *pollFailures) stop() []string {
+	pf.Lock()
+	defer pf.Unlock()
+
+	failed := make([]string, 0, len(pf.pollers))
+	for name := range pf.pollers {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+
+	pf.collecting = false
+	pf.pollers = nil
+	return failed
+}
+
+// record notes err against the poller named in ctx, if any, and reports
+// whether failures are being collected.
+func (pf *pollFailures) record(ctx slog.Context, err error) bool {
+	pf.Lock()
+	defer pf.Unlock()
+	if !pf.collecting {
+		return false
+	}
+
+	name, _ := ctx["poller"].(string)
+	if name == "" {
+		name, _ = ctx["fn"].(string)
+	}
+	if _, seen := pf.pollers[name]; name != "" && !seen {
+		pf.pollers[name] = err
+	}
+	return true
+}
+
+// run calls fn, recording name as failed if FatalError stops it
+func (pf *pollFailures) run(name string, fn func()) {
+	finished := false
+	defer func() {
+		if !finished {
+			pf.record(slog.Context{"poller": name}, errStopped)
+		}
+	}()
+
+	fn()
+	finished = true
+}
+
+type onceJSONMeasurement struct {
+	Name   string            `json:"name"`
+	Value  interface{}       `json:"value"`
+	Type   string            `json:"type"`
+	Unit   string            `json:"unit,omitempty"`
+	Time   time.Time         `json:"time"`
+	Source string            `json:"source,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+}
+
+// WriteMeasurements writes mms to w in one of OnceFormats
+func WriteMeasurements(w io.Writer, mms []Measurement, format string, config Config) error {
+	switch format {
+	case "text":
+		for _, mm := range mms {
+			line := fmt.Sprintf("%s %s", mm.Name(config.Prefix), mm.StrValue())
+			if unit := mm.Unit(); unit != Empty {
+				line = fmt.Sprintf("%s %s", line, unit.Abbr())
+			}
+			if t, ok := mm.(TaggedMeasurement); ok {
+				for _, k := range t.SortedTagKeys() {
+					line = fmt.Sprintf("%s %s=%s", line, k, t.Tags()[k])
+				}
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "l2met":
+		for _, mm := range mms {
+			if _, err := fmt.Fprintln(w, l2metLine(mm, config.Prefix, config.Source)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "json":
+		out := make([]onceJSONMeasurement, 0, len(mms))
+		for _, mm := range mms {
+			jm := onceJSONMeasurement{
+				Name:   mm.Name(config.Prefix),
+				Value:  mm.Value(),
+				Type:   "gauge",
+				Unit:   mm.Unit().Name(),
+				Time:   mm.Time(),
+				Source: config.Source,
+			}
+			if mm.Type() == CounterType {
+				jm.Type = "counter"
+			}
+			if t, ok := mm.(TaggedMeasurement); ok {
+				if t.Source() != "" {
+					jm.Source = t.Source()
+				}
+				jm.Tags = t.Tags()
+			}
+			out = append(out, jm)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(OnceFormats, ", "))
+}
@@ -0,0 +1,136 @@
+package shh
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heroku/slog"
+)
+
+func TestWriteMeasurements(t *testing.T) {
+	when := time.Date(2014, 1, 29, 1, 1, 1, 0, time.UTC)
+	mms := []Measurement{
+		FloatGaugeMeasurement{when, "cpu", []string{"cpu", "user"}, 1.5, Percent},
+		TaggedMeasurement{CounterMeasurement{when, "listen", []string{"requests"}, 10, Empty}, "web.1", map[string]string{"app": "api"}},
+	}
+	config := Config{Prefix: "host"}
+
+	var buf bytes.Buffer
+	if err := WriteMeasurements(&buf, mms, "text", config); err != nil {
+		t.Fatal(err)
+	}
+	expected := "host.cpu.cpu.user 1.500000 %\nhost.listen.requests 10 app=api\n"
+	if buf.String() != expected {
+		t.Errorf("Should have written %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteMeasurements(&buf, mms, "l2met", config); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || !strings.HasSuffix(lines[1], "tag#app=api source=web.1") {
+		t.Errorf("Should have written 2 l2met lines, got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteMeasurements(&buf, mms, "json", config); err != nil {
+		t.Fatal(err)
+	}
+	var out []onceJSONMeasurement
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("Should have written valid json: %s", err)
+	}
+	if len(out) != 2 || out[1].Type != "counter" || out[1].Source != "web.1" || out[0].Unit != "Percent" {
+		t.Errorf("Should have written both measurements as json, got %+v", out)
+	}
+
+	if err := WriteMeasurements(&buf, mms, "xml", config); err == nil {
+		t.Errorf("Should have rejected an unknown format")
+	}
+}
+
+func TestCollectOnce(t *testing.T) {
+	config := Config{Pollers: []string{"load", "listen"}}
+
+	mms, failed := CollectOnce(config, 10*time.Millisecond)
+	if len(failed) != 0 {
+		t.Errorf("Should not have found any failed pollers, got %v", failed)
+	}
+	if len(mms) == 0 {
+		t.Fatalf("Should have collected measurements from the load poller")
+	}
+
+	for i, mm := range mms {
+		if !mm.Time().Equal(mms[0].Time()) {
+			t.Errorf("Should only have returned measurements from the second poll")
+		}
+		if strings.HasPrefix(mm.Name(""), "listen.") {
+			t.Errorf("Should have skipped the listen poller, got %s", mm.Name(""))
+		}
+		if i > 0 && mm.Name("") < mms[i-1].Name("") {
+			t.Errorf("Should have sorted measurements by name")
+		}
+	}
+}
+
+type failingPoller struct {
+	name  string
+	fatal bool
+}
+
+func (poller failingPoller) Poll(tick time.Time) {
+	ctx := slog.Context{"poller": poller.name, "fn": "Poll"}
+	if poller.fatal {
+		FatalError(ctx, errors.New("boom"), "polling")
+	}
+	LogError(ctx, errors.New("boom"), "polling")
+}
+
+func (poller failingPoller) Name() string { return poller.name }
+func (poller failingPoller) Exit()        {}
+
+// spawningPoller fails in a goroutine of its own, like df's reading of the
+// mount table.
+type spawningPoller struct{}
+
+func (poller spawningPoller) Poll(tick time.Time) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		FatalError(slog.Context{"fn": "readThings"}, errors.New("boom"), "reading")
+	}()
+	<-done
+}
+
+func (poller spawningPoller) Name() string { return "spawns" }
+func (poller spawningPoller) Exit()        {}
+
+func TestCollectOnce_Failures(t *testing.T) {
+	failures.start()
+	measurements := make(chan Measurement, 10)
+	mp := NewMultiPoller(measurements, Config{Pollers: []string{"nope", "redis"}, RedisInfo: "bad"})
+	mp.RegisterPoller(failingPoller{name: "logs"})
+	mp.RegisterPoller(failingPoller{name: "dies", fatal: true})
+	mp.RegisterPoller(spawningPoller{})
+	mp.Poll(time.Now())
+	failed := failures.stop()
+
+	expected := []string{"dies", "logs", "nope", "readThings", "redis"}
+	if !reflect.DeepEqual(failed, expected) {
+		t.Errorf("Should have found %v failed, got %v", expected, failed)
+	}
+	if _, ok := mp.pollers["redis"]; ok {
+		t.Errorf("Should have left out the redis poller, which failed to be created")
+	}
+
+	// once collection has stopped, errors aren't recorded anymore
+	LogError(slog.Context{"poller": "logs"}, errors.New("boom"), "polling")
+	if failures.pollers != nil {
+		t.Errorf("Should not have recorded errors after stopping")
+	}
+}
@@ -8,6 +8,9 @@ type Outputter interface {
 	Start()
 }
 
+// KnownOutputters are the names of the outputters NewOutputter can create
+var KnownOutputters = []string{"carbon", "librato", "statsd", "stdoutl2metder", "stdoutl2metraw"}
+
 //
 // FIXME: Any way to do this with reflect and a map?
 func NewOutputter(name string, measurements <-chan Measurement, config Config) (Outputter, error) {
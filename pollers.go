@@ -1,8 +1,11 @@
 package shh
 
 import (
+	"fmt"
 	"sync"
 	"time"
+
+	"github.com/heroku/slog"
 )
 
 type Poller interface {
@@ -11,56 +14,91 @@ type Poller interface {
 	Poll(tick time.Time)
 }
 
-func NewMultiPoller(measurements chan<- Measurement, config Config) Multi {
-	mp := Multi{pollers: make(map[string]Poller), measurements: measurements, meta: config.Meta}
+// KnownPollers are the names of the pollers NewMultiPoller can create
+var KnownPollers = []string{
+	"cgroup", "conntrack", "containers", "cpu", "df", "disk", "filenr", "folsom", "listen", "load",
+	"mem", "nagios3stats", "netstat", "nif", "ntpdate", "pressure", "processes", "redis", "self",
+	"sockstat", "splunksearchpeers", "syslogngstats", "tcp", "vmstat",
+}
+
+func NewMultiPoller(measurements chan<- Measurement, config Config) *Multi {
+	mp := &Multi{pollers: make(map[string]Poller), measurements: measurements, meta: config.Meta}
 
 	for _, poller := range config.Pollers {
-		switch poller {
-		case "load":
-			mp.RegisterPoller(NewLoadPoller(measurements))
-		case "cpu":
-			mp.RegisterPoller(NewCpuPoller(measurements, config))
-		case "df":
-			mp.RegisterPoller(NewDfPoller(measurements, config))
-		case "disk":
-			mp.RegisterPoller(NewDiskPoller(measurements, config))
-		case "filenr":
-			mp.RegisterPoller(NewFileNrPoller(measurements))
-		case "listen":
-			mp.RegisterPoller(NewListenPoller(measurements, config))
-		case "mem":
-			mp.RegisterPoller(NewMemoryPoller(measurements, config))
-		case "nagios3stats":
-			mp.RegisterPoller(NewNagios3StatsPoller(measurements, config))
-		case "nif":
-			mp.RegisterPoller(NewNetworkInterfacePoller(measurements, config))
-		case "ntpdate":
-			mp.RegisterPoller(NewNtpdatePoller(measurements, config))
-		case "processes":
-			mp.RegisterPoller(NewProcessesPoller(measurements, config))
-		case "self":
-			mp.RegisterPoller(NewSelfPoller(measurements, config))
-		case "conntrack":
-			mp.RegisterPoller(NewConntrackPoller(measurements))
-		case "syslogngstats":
-			mp.RegisterPoller(NewSyslogngStatsPoller(measurements, config))
-		case "sockstat":
-			mp.RegisterPoller(NewSockStatPoller(measurements, config))
-		case "splunksearchpeers":
-			mp.RegisterPoller(NewSplunkSearchPeersPoller(measurements, config))
-		case "folsom":
-			mp.RegisterPoller(NewFolsomPoller(measurements, config))
-		case "redis":
-			mp.RegisterPoller(NewRedisPoller(measurements, config))
-		case "cgroup":
-			mp.RegisterPoller(NewCgroupPoller(measurements, config))
-
-		}
+		mp.registerKnownPoller(poller, config)
 	}
 
 	return mp
 }
 
+// registerKnownPoller creates and registers the named poller. It's created
+// on a goroutine of its own, so that if it calls FatalError while
+// CollectOnce runs, it's only left out and reported as failed.
+func (mp *Multi) registerKnownPoller(poller string, config Config) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		failures.run(poller, func() { mp.newKnownPoller(poller, config) })
+	}()
+	<-done
+}
+
+func (mp *Multi) newKnownPoller(poller string, config Config) {
+	measurements := mp.measurements
+	switch poller {
+	case "load":
+		mp.RegisterPoller(NewLoadPoller(measurements, config))
+	case "cpu":
+		mp.RegisterPoller(NewCpuPoller(measurements, config))
+	case "df":
+		mp.RegisterPoller(NewDfPoller(measurements, config))
+	case "disk":
+		mp.RegisterPoller(NewDiskPoller(measurements, config))
+	case "filenr":
+		mp.RegisterPoller(NewFileNrPoller(measurements, config))
+	case "listen":
+		mp.RegisterPoller(NewListenPoller(measurements, config))
+	case "mem":
+		mp.RegisterPoller(NewMemoryPoller(measurements, config))
+	case "nagios3stats":
+		mp.RegisterPoller(NewNagios3StatsPoller(measurements, config))
+	case "nif":
+		mp.RegisterPoller(NewNetworkInterfacePoller(measurements, config))
+	case "ntpdate":
+		mp.RegisterPoller(NewNtpdatePoller(measurements, config))
+	case "processes":
+		mp.RegisterPoller(NewProcessesPoller(measurements, config))
+	case "self":
+		mp.RegisterPoller(NewSelfPoller(measurements, config))
+	case "conntrack":
+		mp.RegisterPoller(NewConntrackPoller(measurements, config))
+	case "syslogngstats":
+		mp.RegisterPoller(NewSyslogngStatsPoller(measurements, config))
+	case "sockstat":
+		mp.RegisterPoller(NewSockStatPoller(measurements, config))
+	case "splunksearchpeers":
+		mp.RegisterPoller(NewSplunkSearchPeersPoller(measurements, config))
+	case "folsom":
+		mp.RegisterPoller(NewFolsomPoller(measurements, config))
+	case "redis":
+		mp.RegisterPoller(NewRedisPoller(measurements, config))
+	case "cgroup":
+		mp.RegisterPoller(NewCgroupPoller(measurements, config))
+	case "pressure":
+		mp.RegisterPoller(NewPressurePoller(measurements, config))
+	case "containers":
+		mp.RegisterPoller(NewContainersPoller(measurements, config))
+	case "vmstat":
+		mp.RegisterPoller(NewVmstatPoller(measurements, config))
+	case "netstat":
+		mp.RegisterPoller(NewNetstatPoller(measurements, config))
+	case "tcp":
+		mp.RegisterPoller(NewTcpPoller(measurements, config))
+	default:
+		LogError(slog.Context{"fn": "NewMultiPoller", "poller": poller}, fmt.Errorf("unknown poller %q", poller), "skipping it")
+	}
+}
+
 type Multi struct {
 	sync.WaitGroup
 	measurements chan<- Measurement
@@ -68,36 +106,36 @@ type Multi struct {
 	meta         bool
 }
 
-func (mp Multi) RegisterPoller(poller Poller) {
+func (mp *Multi) RegisterPoller(poller Poller) {
 	mp.pollers[poller.Name()] = poller
 }
 
-func (mp Multi) durationMetric(tick time.Time, name string, start time.Time) {
+func (mp *Multi) durationMetric(tick time.Time, name string, start time.Time) {
 	if mp.meta {
 		mp.measurements <- FloatGaugeMeasurement{tick, mp.Name(), []string{"duration", name, "seconds"}, time.Since(start).Seconds(), Seconds}
 	}
 }
 
-func (mp Multi) Poll(tick time.Time) {
+func (mp *Multi) Poll(tick time.Time) {
 	defer mp.durationMetric(tick, "all", time.Now())
 
 	for _, poller := range mp.pollers {
 		mp.Add(1)
 		go func(poller Poller) {
+			defer mp.Done()
 			defer mp.durationMetric(tick, poller.Name(), time.Now())
-			poller.Poll(tick)
-			mp.Done()
+			failures.run(poller.Name(), func() { poller.Poll(tick) })
 		}(poller)
 	}
 
 	mp.Wait()
 }
 
-func (mp Multi) Name() string {
+func (mp *Multi) Name() string {
 	return "multi_poller"
 }
 
-func (mp Multi) Exit() {
+func (mp *Multi) Exit() {
 	for _, poller := range mp.pollers {
 		poller.Exit()
 	}
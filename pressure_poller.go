@@ -0,0 +1,132 @@
+package shh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/heroku/slog"
+)
+
+const (
+	PRESSURE_DATA = "/proc/pressure"
+)
+
+// Resources reported on, irq only from Linux 6.1
+var pressureResources = []string{"cpu", "memory", "io", "irq"}
+
+// some is the share of time at least one task was stalled on the resource,
+// full the share of time all non-idle tasks were.
+var pressureMetrics = []MetricDescriptor{
+	pollerErrorMetric("pressure"),
+	{"pressure.cgroup.<cgroup>.<resource>.<kind>.avg10", FloatGaugeType, Percent, "Share of the last 10s the cgroup's tasks were stalled on the resource", "SHH_PRESSURE_CGROUPS=true"},
+	{"pressure.cgroup.<cgroup>.<resource>.<kind>.avg60", FloatGaugeType, Percent, "Share of the last 60s the cgroup's tasks were stalled on the resource", "SHH_PRESSURE_CGROUPS=true"},
+	{"pressure.cgroup.<cgroup>.<resource>.<kind>.avg300", FloatGaugeType, Percent, "Share of the last 300s the cgroup's tasks were stalled on the resource", "SHH_PRESSURE_CGROUPS=true"},
+	{"pressure.cgroup.<cgroup>.<resource>.<kind>.total", CounterType, MicroSeconds, "Time the cgroup's tasks were stalled on the resource", "SHH_PRESSURE_CGROUPS=true"},
+	{"pressure.<resource>.<kind>.avg10", FloatGaugeType, Percent, "Share of the last 10s tasks were stalled on the resource", ""},
+	{"pressure.<resource>.<kind>.avg60", FloatGaugeType, Percent, "Share of the last 60s tasks were stalled on the resource", ""},
+	{"pressure.<resource>.<kind>.avg300", FloatGaugeType, Percent, "Share of the last 300s tasks were stalled on the resource", ""},
+	{"pressure.<resource>.<kind>.total", CounterType, MicroSeconds, "Time tasks were stalled on the resource", ""},
+}
+
+type Pressure struct {
+	measurements chan<- Measurement
+	path         string
+	cgroups      *Cgroup // when SHH_PRESSURE_CGROUPS is set
+}
+
+func NewPressurePoller(measurements chan<- Measurement, config Config) Pressure {
+	poller := Pressure{
+		measurements: measurements,
+		path:         config.procPath(PRESSURE_DATA),
+	}
+
+	if config.PressureCgroups {
+		// only borrow the cgroup poller's discovery, without its sampler
+		config.CgroupReadOnly = false
+		cgroups := NewCgroupPoller(nil, config)
+		if cgroups.unified {
+			poller.cgroups = &cgroups
+		} else {
+			LogError(slog.Context{"poller": poller.Name(), "fn": "NewPressurePoller"}, fmt.Errorf("cgroup v1 hierarchy"), "per cgroup pressure needs cgroup v2")
+		}
+	}
+
+	return poller
+}
+
+// https://www.kernel.org/doc/html/latest/accounting/psi.html
+func (poller Pressure) Poll(tick time.Time) {
+	ctx := slog.Context{"poller": poller.Name(), "fn": "Poll", "tick": tick}
+
+	found := 0
+	for _, resource := range pressureResources {
+		data, err := ioutil.ReadFile(filepath.Join(poller.path, resource))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			LogError(ctx, err, "reading "+resource+" pressure")
+			poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
+			continue
+		}
+		found++
+		poller.report(tick, []string{resource}, string(data))
+	}
+
+	if found == 0 {
+		LogError(ctx, fmt.Errorf("%s not found", poller.path), "reading pressure, is the kernel built with CONFIG_PSI?")
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
+	}
+
+	if poller.cgroups == nil {
+		return
+	}
+
+	for _, cgroup := range poller.cgroups.discover() {
+		for _, resource := range pressureResources {
+			// files of cgroups that have gone away, or of resources the
+			// kernel doesn't track, are skipped
+			data, err := ioutil.ReadFile(filepath.Join(poller.cgroups.path, cgroup, resource+".pressure"))
+			if err != nil {
+				continue
+			}
+			poller.report(tick, []string{"cgroup", poller.cgroups.metricName(cgroup), resource}, string(data))
+		}
+	}
+}
+
+// report emits the contents of a pressure file, with lines like
+// "some avg10=0.12 avg60=0.34 avg300=0.56 total=7890", named after prefix.
+func (poller Pressure) report(tick time.Time, prefix []string, data string) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := fields[0]
+
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			what := append(append([]string{}, prefix...), kind, kv[0])
+			if kv[0] == "total" {
+				poller.measurements <- CounterMeasurement{tick, poller.Name(), what, Atouint64(kv[1]), MicroSeconds}
+			} else {
+				poller.measurements <- FloatGaugeMeasurement{tick, poller.Name(), what, Atofloat64(kv[1]), Percent}
+			}
+		}
+	}
+}
+
+func (poller Pressure) Name() string {
+	return "pressure"
+}
+
+func (poller Pressure) Exit() {}
@@ -0,0 +1,54 @@
+package shh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPressurePoller(t *testing.T) {
+	pressure := "some avg10=1.50 avg60=0.75 avg300=0.25 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"
+	root := newFixture(t, map[string]string{
+		"proc/pressure/cpu":                                      pressure,
+		"proc/pressure/memory":                                   pressure,
+		"proc/pressure/io":                                       pressure,
+		"sys/fs/cgroup/cgroup.controllers":                       "cpu memory io\n",
+		"sys/fs/cgroup/system.slice/web.service/cpu.pressure":    pressure,
+		"sys/fs/cgroup/system.slice/web.service/memory.pressure": pressure,
+	})
+
+	config := Config{
+		ProcRoot:        root + "/proc",
+		SysRoot:         root + "/sys",
+		Cgroups:         []string{"system.slice/*.service"},
+		PressureCgroups: true,
+	}
+	values := pollValues(t, func(measurements chan<- Measurement) {
+		NewPressurePoller(measurements, config).Poll(time.Now())
+	})
+
+	expected := map[string]string{
+		"pressure.cpu.some.avg10":                                     "1.500000",
+		"pressure.memory.some.avg300":                                 "0.250000",
+		"pressure.io.some.total":                                      "123456",
+		"pressure.io.full.avg60":                                      "0.000000",
+		"pressure.cgroup.system-slice--web-service.cpu.some.avg60":    "0.750000",
+		"pressure.cgroup.system-slice--web-service.memory.full.total": "0",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+
+	for _, name := range []string{"pressure.error", "pressure.irq.full.avg10", "pressure.cgroup.system-slice--web-service.io.some.avg10"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("Should not have reported %s", name)
+		}
+	}
+}
+
+func TestPressurePoller_Unavailable(t *testing.T) {
+	checkPollError(t, "pressure", func(measurements chan<- Measurement) {
+		NewPressurePoller(measurements, Config{ProcRoot: "/nonexistent"}).Poll(time.Now())
+	})
+}
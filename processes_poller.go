@@ -16,6 +16,30 @@ const (
 	PROC = "/proc"
 )
 
+// Per process metrics are reported for processes whose names match
+// SHH_PROCESSES_REGEX, summed across processes with the same name.
+var processesMetrics = []MetricDescriptor{
+	{"processes.running.count", GaugeType, Processes, "Processes running", ""},
+	{"processes.sleeping.count", GaugeType, Processes, "Processes sleeping", ""},
+	{"processes.waiting.count", GaugeType, Processes, "Processes in uninterruptible disk sleep", ""},
+	{"processes.zombie.count", GaugeType, Processes, "Zombie processes", ""},
+	{"processes.stopped.count", GaugeType, Processes, "Processes stopped", ""},
+	{"processes.paging.count", GaugeType, Processes, "Processes paging", ""},
+	{"processes.<name>.procs.count", GaugeType, Processes, "Processes with the name", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.threads.count", GaugeType, Threads, "Threads of the processes", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.cpu.sys.seconds", FloatGaugeType, Seconds, "CPU time used in kernel mode", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.cpu.user.seconds", FloatGaugeType, Seconds, "CPU time used in user mode", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.mem.pagefaults.minor.count", GaugeType, Faults, "Minor page faults", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.mem.pagefaults.major.count", GaugeType, Faults, "Major page faults", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.mem.rss.bytes", GaugeType, Bytes, "Resident set size", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.mem.stacksize.bytes", GaugeType, Bytes, "Stack size", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.mem.virtual.bytes", GaugeType, Bytes, "Virtual memory size", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.io.read.bytes", GaugeType, Bytes, "Bytes read from storage", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.io.write.bytes", GaugeType, Bytes, "Bytes written to storage", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.io.read.ops", GaugeType, Ops, "Read system calls", "SHH_PROCESSES_REGEX"},
+	{"processes.<name>.io.write.ops", GaugeType, Ops, "Write system calls", "SHH_PROCESSES_REGEX"},
+}
+
 type ProcInfo struct {
 	name                              string
 	pid                               int
@@ -33,6 +57,7 @@ type Procs struct {
 	regex        *regexp.Regexp
 	ticks        float64
 	pageSize     uint64
+	proc         string
 }
 
 func NewProcessesPoller(measurements chan<- Measurement, config Config) Procs {
@@ -41,15 +66,16 @@ func NewProcessesPoller(measurements chan<- Measurement, config Config) Procs {
 		regex:        config.ProcessesRegex,
 		ticks:        float64(config.Ticks),
 		pageSize:     uint64(config.PageSize),
+		proc:         config.procPath(PROC),
 	}
 }
 
 func (poller Procs) Poll(tick time.Time) {
 	ctx := slog.Context{"poller": poller.Name(), "fn": "Poll", "tick": tick}
 
-	dir, err := os.Open(PROC)
+	dir, err := os.Open(poller.proc)
 	if err != nil {
-		FatalError(ctx, err, "opening "+PROC)
+		FatalError(ctx, err, "opening "+poller.proc)
 	}
 
 	defer dir.Close()
@@ -151,7 +177,7 @@ func (poller Procs) GetProcInfo(pid int) (pInfo ProcInfo) {
 }
 
 func (poller Procs) ScanProcStat(pInfo *ProcInfo) {
-	statFile := fmt.Sprintf("%s/%d/stat", PROC, pInfo.pid)
+	statFile := fmt.Sprintf("%s/%d/stat", poller.proc, pInfo.pid)
 
 	statData, err := ioutil.ReadFile(statFile)
 
@@ -187,7 +213,7 @@ func (poller Procs) ScanProcStat(pInfo *ProcInfo) {
 }
 
 func (poller Procs) ScanProcIo(pInfo *ProcInfo) {
-	ioFile := fmt.Sprintf("%s/%d/io", PROC, pInfo.pid)
+	ioFile := fmt.Sprintf("%s/%d/io", poller.proc, pInfo.pid)
 
 	ioData, err := ioutil.ReadFile(ioFile)
 
@@ -215,7 +241,7 @@ func (poller Procs) ScanProcIo(pInfo *ProcInfo) {
 }
 
 func (poller Procs) ScanProcStatus(pInfo *ProcInfo) {
-	statusFile := fmt.Sprintf("%s/%d/status", PROC, pInfo.pid)
+	statusFile := fmt.Sprintf("%s/%d/status", poller.proc, pInfo.pid)
 
 	statusData, err := ioutil.ReadFile(statusFile)
 
@@ -0,0 +1,233 @@
+package shh
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/heroku/slog"
+)
+
+// recordedMeasurement is a measurement as it's stored in a recording
+type recordedMeasurement struct {
+	Type       MeasurementType
+	Time       time.Time
+	Poller     string
+	What       []string
+	Value      uint64
+	FloatValue float64
+	UnitName   string
+	UnitAbbr   string
+	Source     string
+	Tags       map[string]string
+}
+
+func newRecordedMeasurement(mm Measurement) (recordedMeasurement, error) {
+	var rm recordedMeasurement
+
+	if t, ok := mm.(TaggedMeasurement); ok {
+		rm.Source = t.Source()
+		rm.Tags = t.Tags()
+		mm = t.Measurement
+	}
+
+	switch m := mm.(type) {
+	case CounterMeasurement:
+		rm.Type, rm.Time, rm.Poller, rm.What, rm.Value = CounterType, m.time, m.poller, m.what, m.value
+	case GaugeMeasurement:
+		rm.Type, rm.Time, rm.Poller, rm.What, rm.Value = GaugeType, m.time, m.poller, m.what, m.value
+	case FloatGaugeMeasurement:
+		rm.Type, rm.Time, rm.Poller, rm.What, rm.FloatValue = FloatGaugeType, m.time, m.poller, m.what, m.value
+	default:
+		return rm, fmt.Errorf("can't record a %T", mm)
+	}
+
+	rm.UnitName, rm.UnitAbbr = mm.Unit().Name(), mm.Unit().Abbr()
+	return rm, nil
+}
+
+func (rm recordedMeasurement) measurement() (Measurement, error) {
+	var mm Measurement
+	unit := Unit{rm.UnitName, rm.UnitAbbr}
+
+	switch rm.Type {
+	case CounterType:
+		mm = CounterMeasurement{rm.Time, rm.Poller, rm.What, rm.Value, unit}
+	case GaugeType:
+		mm = GaugeMeasurement{rm.Time, rm.Poller, rm.What, rm.Value, unit}
+	case FloatGaugeType:
+		mm = FloatGaugeMeasurement{rm.Time, rm.Poller, rm.What, rm.FloatValue, unit}
+	default:
+		return nil, fmt.Errorf("unknown measurement type %d", rm.Type)
+	}
+
+	if rm.Source != "" || len(rm.Tags) > 0 {
+		mm = TaggedMeasurement{mm, rm.Source, rm.Tags}
+	}
+	return mm, nil
+}
+
+// Recorder writes every measurement passing through it to a file, as a gob
+// stream, so it can be replayed later.
+type Recorder struct {
+	sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+	enc  *gob.Encoder
+
+	stop    chan struct{} // closed by Close to stop Tee
+	stopped chan struct{} // closed by Tee once it has stopped
+}
+
+// NewRecorder creates, or truncates, the recording at path
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bufio.NewWriter(file)
+	return &Recorder{file: file, buf: buf, enc: gob.NewEncoder(buf)}, nil
+}
+
+// Record writes mm to the recording
+func (r *Recorder) Record(mm Measurement) error {
+	rm, err := newRecordedMeasurement(mm)
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	return r.enc.Encode(rm)
+}
+
+// Flush writes any buffered measurements to the file
+func (r *Recorder) Flush() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.buf.Flush()
+}
+
+// Close stops any Tee, recording the measurements already queued for it,
+// then flushes and closes the recording. It's safe to call on a nil
+// Recorder.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	if r.stop != nil {
+		close(r.stop)
+		<-r.stopped
+	}
+
+	if err := r.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// Tee records every measurement from in, passing them on to the returned
+// channel, until in is closed or the Recorder is. The recording is flushed
+// whenever in is drained, so it's never far behind the outputter.
+func (r *Recorder) Tee(in <-chan Measurement) <-chan Measurement {
+	out := make(chan Measurement, cap(in))
+	r.stop = make(chan struct{})
+	r.stopped = make(chan struct{})
+
+	go func() {
+		ctx := slog.Context{"fn": "Tee", "file": r.file.Name()}
+		defer close(r.stopped)
+		defer close(out)
+
+		record := func(mm Measurement) {
+			if err := r.Record(mm); err != nil {
+				LogError(ctx, err, "recording measurement")
+			}
+		}
+
+		for {
+			select {
+			case mm, ok := <-in:
+				if !ok {
+					return
+				}
+				record(mm)
+				if len(in) == 0 {
+					if err := r.Flush(); err != nil {
+						LogError(ctx, err, "flushing recording")
+					}
+				}
+				select {
+				case out <- mm:
+				case <-r.stop:
+					r.drain(in, record)
+					return
+				}
+			case <-r.stop:
+				r.drain(in, record)
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// drain records the measurements already queued on in, for Tee as it stops
+func (r *Recorder) drain(in <-chan Measurement, record func(Measurement)) {
+	for len(in) > 0 {
+		mm, ok := <-in
+		if !ok {
+			return
+		}
+		record(mm)
+	}
+}
+
+// Replay sends the measurements recorded at path to measurements. If
+// realtime is set they are spaced out as they were recorded, otherwise
+// they're sent as fast as measurements is read. It returns how many
+// measurements were replayed.
+func Replay(path string, measurements chan<- Measurement, realtime bool) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(file))
+
+	var last time.Time
+	count := 0
+	for {
+		var rm recordedMeasurement
+		if err := dec.Decode(&rm); err != nil {
+			if err == io.EOF {
+				return count, nil
+			}
+			return count, fmt.Errorf("reading measurement %d: %s", count+1, err)
+		}
+
+		mm, err := rm.measurement()
+		if err != nil {
+			return count, fmt.Errorf("reading measurement %d: %s", count+1, err)
+		}
+
+		if realtime && !last.IsZero() && rm.Time.After(last) {
+			time.Sleep(rm.Time.Sub(last))
+		}
+		if last.IsZero() || rm.Time.After(last) {
+			last = rm.Time
+		}
+
+		measurements <- mm
+		count++
+	}
+}
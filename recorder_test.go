@@ -0,0 +1,119 @@
+package shh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecorder_RoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording")
+
+	now := time.Now().Round(0)
+	mms := []Measurement{
+		CounterMeasurement{now, "cpu", []string{"cpu0", "user"}, 10, Empty},
+		GaugeMeasurement{now, "mem", []string{"memfree"}, 1024, Bytes},
+		FloatGaugeMeasurement{now.Add(20 * time.Millisecond), "load", []string{"1m"}, 0.5, Avg},
+		TaggedMeasurement{GaugeMeasurement{now, "listen", []string{"queue"}, 3, Empty}, "web.1", map[string]string{"dyno": "web"}},
+	}
+
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := make(chan Measurement, len(mms))
+	out := recorder.Tee(in)
+	for _, mm := range mms {
+		in <- mm
+	}
+	close(in)
+	for range out {
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := make(chan Measurement, len(mms))
+	start := time.Now()
+	count, err := Replay(path, replayed, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(mms) {
+		t.Fatalf("Should have replayed %d measurements, got %d", len(mms), count)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Should have spaced out the measurements as they were recorded")
+	}
+
+	for _, expected := range mms {
+		mm := <-replayed
+		if !reflect.DeepEqual(mm, expected) {
+			t.Errorf("Should have replayed %#v, got %#v", expected, mm)
+		}
+	}
+}
+
+func TestReplay_BadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := Replay(filepath.Join(dir, "missing"), make(chan Measurement), false); err == nil {
+		t.Errorf("Should have failed to replay a missing file")
+	}
+
+	path := filepath.Join(dir, "garbage")
+	if err := ioutil.WriteFile(path, []byte("not a recording"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Replay(path, make(chan Measurement), false); err == nil {
+		t.Errorf("Should have failed to replay a corrupt file")
+	}
+}
+
+func TestRecorder_CloseStopsTee(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording")
+
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing reads out, so once it's full Tee is stuck passing on the
+	// second measurement while the third is queued
+	in := make(chan Measurement, 1)
+	recorder.Tee(in)
+	now := time.Now()
+	in <- GaugeMeasurement{now, "mem", []string{"memfree"}, 1, Bytes}
+	in <- GaugeMeasurement{now, "mem", []string{"memfree"}, 2, Bytes}
+	in <- GaugeMeasurement{now, "mem", []string{"memfree"}, 3, Bytes}
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := make(chan Measurement, 3)
+	count, err := Replay(path, replayed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("Should have recorded the 3 measurements sent before closing, got %d", count)
+	}
+}
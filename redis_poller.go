@@ -3,6 +3,7 @@ package shh
 import (
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -39,6 +40,26 @@ var (
 	}
 )
 
+// redisMetrics describes the keys of SHH_REDIS_INFO, which are gauges if
+// they're in RedisKnownGauges and counters otherwise.
+func redisMetrics() []MetricDescriptor {
+	gauges := make([]string, 0, len(RedisKnownGauges))
+	for key := range RedisKnownGauges {
+		gauges = append(gauges, key)
+	}
+	sort.Strings(gauges)
+
+	mds := []MetricDescriptor{
+		pollerErrorMetric("redis"),
+		{"redis.error.info.<section>", GaugeType, Errors, "1 when a section of INFO couldn't be read", ""},
+	}
+	for _, key := range gauges {
+		name := "redis." + MetricNameNormalizer.Replace(strings.Replace(key, ":", ".", 1))
+		mds = append(mds, MetricDescriptor{name, GaugeType, Empty, "The " + key + " field of INFO", "SHH_REDIS_INFO"})
+	}
+	return append(mds, MetricDescriptor{"redis.<section>.<key>", CounterType, Empty, "Any other field of INFO", "SHH_REDIS_INFO"})
+}
+
 // Redis poller
 // info contains a mapping for the section to the keys that you want for each key.
 // See DEFAULT_REDIS_INFO comment
@@ -51,18 +72,29 @@ type Redis struct {
 // NewRedisPoller constructs a functioning Redis poller from the provided config and reports on the provided channel
 func NewRedisPoller(measurements chan<- Measurement, config Config) Redis {
 	ctx := slog.Context{"poller": "redis", "fn": "NewRedisPoller"}
+
+	info, err := parseRedisInfo(config.RedisInfo)
+	if err != nil {
+		FatalError(ctx, err, "")
+	}
+
+	return Redis{measurements: measurements, url: config.RedisUrl, info: info}
+}
+
+// parseRedisInfo parses SHH_REDIS_INFO into the keys wanted from each
+// section.
+func parseRedisInfo(s string) (map[string][]string, error) {
 	info := make(map[string][]string)
 
-	for _, sectionInfo := range strings.Split(config.RedisInfo, ";") {
+	for _, sectionInfo := range strings.Split(s, ";") {
 		section := strings.Split(sectionInfo, ":")
-		if len(section) == 2 {
-			info[section[0]] = strings.Split(section[1], ",")
-		} else {
-			FatalError(ctx, fmt.Errorf("Expected sectionName:keys"), "")
+		if len(section) != 2 || section[0] == "" || section[1] == "" {
+			return nil, fmt.Errorf("Expected sectionName:keys, got %q", sectionInfo)
 		}
+		info[section[0]] = strings.Split(section[1], ",")
 	}
 
-	return Redis{measurements: measurements, url: config.RedisUrl, info: info}
+	return info, nil
 }
 
 // Poll executes the polling of the provided redis server.
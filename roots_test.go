@@ -0,0 +1,72 @@
+package shh
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func ExampleConfig_procPath() {
+	config := Config{ProcRoot: "/host/proc"}
+	fmt.Println(config.procPath(CPU_DATA))
+	fmt.Println(config.procPath("/sys/block"))
+	fmt.Println(Config{}.procPath(CPU_DATA))
+	fmt.Println(Config{HostRoot: "/host"}.hostPath("/var/lib"))
+	fmt.Println(config.procNetPath(DEVICE_FILE))
+	fmt.Println(Config{}.procNetPath(DEVICE_FILE))
+	// Output: /host/proc/stat
+	// /sys/block
+	// /proc/stat
+	// /host/var/lib
+	// /host/proc/1/net/dev
+	// /proc/net/dev
+}
+
+// The pollers should read everything from under the configured roots, so
+// they can be pointed at a fixture tree.
+func TestPollers_Roots(t *testing.T) {
+	config := Config{
+		Pollers:        []string{"cpu", "df", "disk", "filenr", "load", "mem", "nif", "sockstat"},
+		DfTypes:        []string{"ext4"},
+		DiskFilter:     regexp.MustCompile("sd"),
+		NifDevices:     []string{"eth0"},
+		SockStatProtos: []string{"TCP"},
+		ProcRoot:       "testdata/roots/proc",
+		SysRoot:        "testdata/roots/sys",
+		HostRoot:       "testdata/roots",
+	}
+
+	values := make(map[string]string)
+	mms, _ := CollectOnce(config, 10*time.Millisecond)
+	for _, mm := range mms {
+		values[mm.Name("")] = mm.StrValue()
+	}
+
+	expected := map[string]string{
+		"load.1m":                     "0.500000",
+		"mem.memfree":                 "1048576000",
+		"filenr.alloc":                "1024",
+		"nif.eth0.receive.bytes":      "5000",
+		"sockstat.tcp.tw":             "3",
+		"disk.sda.write.bytes":        "204800",
+		"disk.sda.in-flight.requests": "0",
+		"cpu.cpu.user":                "0.000000",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have read %s=%s from the fixtures, got %q", name, value, values[name])
+		}
+	}
+
+	// proc/net is the fixture's stand-in for shh's own network namespace
+	for name, value := range map[string]string{"nif.eth0.receive.bytes": "9999", "sockstat.tcp.tw": "99"} {
+		if values[name] == value {
+			t.Errorf("Should have read %s from the network namespace of the fixture's init, not proc/net", name)
+		}
+	}
+
+	if _, ok := values["df.root.total.bytes"]; !ok {
+		t.Errorf("Should have reported df for the mounts of the fixture's init, got %v", values)
+	}
+}
@@ -5,6 +5,33 @@ import (
 	"time"
 )
 
+var selfMetrics = []MetricDescriptor{
+	{"self.memstats.goroutines.num", GaugeType, Routines, "Goroutines", ""},
+	{"self.memstats.general.alloc.inuse.bytes", GaugeType, Bytes, "Bytes allocated and in use", ""},
+	{"self.memstats.general.alloc.bytes", CounterType, Bytes, "Bytes allocated", ""},
+	{"self.memstats.heap.alloc.bytes", GaugeType, Bytes, "Heap bytes allocated and in use", ""},
+	{"self.memstats.heap.inuse.bytes", GaugeType, Bytes, "Heap bytes in in-use spans", ""},
+	{"self.measurements.length", GaugeType, Empty, "Measurements waiting for the outputter", "SHH_FULL=self"},
+	{"self.memstats.general.sys.bytes", GaugeType, Bytes, "Bytes obtained from the OS", "SHH_FULL=self"},
+	{"self.memstats.general.pointer.lookups", CounterType, Empty, "Pointer lookups", "SHH_FULL=self"},
+	{"self.memstats.general.mallocs", CounterType, Empty, "Allocations", "SHH_FULL=self"},
+	{"self.memstats.general.frees", CounterType, Empty, "Frees", "SHH_FULL=self"},
+	{"self.memstats.heap.sys.bytes", GaugeType, Bytes, "Heap bytes obtained from the OS", "SHH_FULL=self"},
+	{"self.memstats.heap.idle.bytes", GaugeType, Bytes, "Heap bytes in idle spans", "SHH_FULL=self"},
+	{"self.memstats.heap.released.bytes", GaugeType, Bytes, "Heap bytes released to the OS", "SHH_FULL=self"},
+	{"self.memstats.heap.objects", GaugeType, Objects, "Objects allocated on the heap", "SHH_FULL=self"},
+	{"self.memstats.stack.inuse", GaugeType, Bytes, "Stack bytes in use", "SHH_FULL=self"},
+	{"self.memstats.stack.sys", GaugeType, Bytes, "Stack bytes obtained from the OS", "SHH_FULL=self"},
+	{"self.memstats.mspan.inuse", GaugeType, Empty, "Bytes of mspan structures in use", "SHH_FULL=self"},
+	{"self.memstats.mspan.sys", GaugeType, Empty, "Bytes of mspan structures obtained from the OS", "SHH_FULL=self"},
+	{"self.memstats.mcache.inuse", GaugeType, Empty, "Bytes of mcache structures in use", "SHH_FULL=self"},
+	{"self.memstats.mcache.sys", GaugeType, Empty, "Bytes of mcache structures obtained from the OS", "SHH_FULL=self"},
+	{"self.memstats.buckhash.sys", GaugeType, Empty, "Bytes of profiling bucket hash tables", "SHH_FULL=self"},
+	{"self.memstats.gc.next", GaugeType, Bytes, "Heap size of the next garbage collection", "SHH_FULL=self"},
+	{"self.memstats.gc.pause.ns", CounterType, NanoSeconds, "Time paused for garbage collection", "SHH_FULL=self"},
+	{"self.memstats.gc.num", CounterType, Empty, "Garbage collections", "SHH_FULL=self"},
+}
+
 type Self struct {
 	measurements chan<- Measurement
 	stats        runtime.MemStats
@@ -10,6 +10,12 @@ const (
 	SOCKSTAT6 = "/proc/net/sockstat6"
 )
 
+// Protocols, from SHH_SOCKSTAT_PROTOS, are lower cased
+var sockstatMetrics = []MetricDescriptor{
+	{"sockstat.<proto>.mem", GaugeType, Empty, "Pages of memory used by the protocol's sockets", ""},
+	{"sockstat.<proto>.<field>", GaugeType, Sockets, "Sockets in use, orphaned, in TIME_WAIT or allocated (inuse, orphan, tw, alloc)", ""},
+}
+
 type SockStat struct {
 	measurements chan<- Measurement
 	files        []string
@@ -28,10 +34,10 @@ func NewSockStatPoller(measurements chan<- Measurement, config Config) SockStat
 
 	filesToPoll := make([]string, 0)
 	if includeV4 {
-		filesToPoll = append(filesToPoll, SOCKSTAT4)
+		filesToPoll = append(filesToPoll, config.procNetPath(SOCKSTAT4))
 	}
 	if includeV6 {
-		filesToPoll = append(filesToPoll, SOCKSTAT6)
+		filesToPoll = append(filesToPoll, config.procNetPath(SOCKSTAT6))
 	}
 
 	return SockStat{
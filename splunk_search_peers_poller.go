@@ -12,6 +12,14 @@ import (
 	"github.com/heroku/slog"
 )
 
+var splunkSearchPeersMetrics = []MetricDescriptor{
+	{"splunksearchpeers.total", GaugeType, Peers, "Search peers", ""},
+	{"splunksearchpeers.up", GaugeType, Peers, "Search peers that are up", ""},
+	{"splunksearchpeers.down", GaugeType, Peers, "Search peers that are down", ""},
+	{"splunksearchpeers.replication.success", GaugeType, Peers, "Search peers replicating successfully", ""},
+	{"splunksearchpeers.replication.failed", GaugeType, Peers, "Search peers failing to replicate", ""},
+}
+
 type SplunkPeers struct {
 	Entries []SplunkPeerEntry `xml:"entry"`
 }
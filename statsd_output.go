@@ -46,12 +46,13 @@ func (out *Statsd) Connect(host string) net.Conn {
 func (s *Statsd) Encode(mm Measurement) string {
 	switch mm.Type() {
 	case CounterType:
-		key := mm.Name(s.prefix)
+		key := measurementKey(s.prefix, mm)
+		cm := Untagged(mm).(CounterMeasurement)
 		last, ok := s.last[key]
-		s.last[key] = mm.(CounterMeasurement)
+		s.last[key] = cm
 		if ok {
-			return fmt.Sprintf("%s:%s|c", key, strconv.FormatUint(
-				mm.(CounterMeasurement).Difference(last), 10))
+			return fmt.Sprintf("%s:%s|c", mm.Name(s.prefix), strconv.FormatUint(
+				cm.Difference(last), 10))
 		}
 	case FloatGaugeType, GaugeType:
 		return fmt.Sprintf("%s:%s|g", mm.Name(s.prefix), mm.StrValue())
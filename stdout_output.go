@@ -21,13 +21,25 @@ func (out *StdOutL2MetRaw) Start() {
 
 func (out *StdOutL2MetRaw) Output() {
 	for mm := range out.measurements {
-		msg := fmt.Sprintf("when=%s sample#%s=%s", mm.Time().Format(time.RFC3339), mm.Name(out.prefix), mm.StrValue())
-		if out.source != "" {
-			Logger.Println(fmt.Sprintf("%s source=%s", msg, out.source))
-			continue
+		Logger.Println(l2metLine(mm, out.prefix, out.source))
+	}
+}
+
+// l2metLine formats mm as an l2met sample, with source as the default source
+func l2metLine(mm Measurement, prefix, source string) string {
+	msg := fmt.Sprintf("when=%s sample#%s=%s", mm.Time().Format(time.RFC3339), mm.Name(prefix), mm.StrValue())
+	if t, ok := mm.(TaggedMeasurement); ok {
+		if t.Source() != "" {
+			source = t.Source()
 		}
-		Logger.Println(msg)
+		for _, k := range t.SortedTagKeys() {
+			msg = fmt.Sprintf("%s tag#%s=%s", msg, k, t.Tags()[k])
+		}
+	}
+	if source != "" {
+		return fmt.Sprintf("%s source=%s", msg, source)
 	}
+	return msg
 }
 
 type StdOutL2MetDer struct {
@@ -58,12 +70,12 @@ func (out *StdOutL2MetDer) Output() {
 	for mm := range out.incoming {
 		switch mm.Type() {
 		case CounterType:
-			key := mm.Name(out.prefix)
+			key := measurementKey(out.prefix, mm)
 			last, found := out.last[key]
-			cm := mm.(CounterMeasurement)
+			cm := Untagged(mm).(CounterMeasurement)
 			out.last[key] = cm
 			if found {
-				out.outgoing <- CounterMeasurement{cm.time, cm.poller, cm.what, cm.Difference(last), Empty}
+				out.outgoing <- Retagged(mm, CounterMeasurement{cm.time, cm.poller, cm.what, cm.Difference(last), Empty})
 			}
 		default:
 			out.outgoing <- mm
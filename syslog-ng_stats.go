@@ -12,6 +12,10 @@ const (
 	FOOTER        = "."
 )
 
+var syslogngStatsMetrics = []MetricDescriptor{
+	{"syslog-ng-stats.<source>.<id>.<instance>.<state>.<type>", CounterType, Empty, "Each counter reported by syslog-ng-ctl stats", ""},
+}
+
 type SyslogngStats struct {
 	measurements chan<- Measurement
 	Socket       string
@@ -0,0 +1,167 @@
+package shh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	SD_LISTEN_FDS_START = 3 // First file descriptor passed by systemd socket activation
+)
+
+// systemdSocket is a socket passed to shh by systemd socket activation
+type systemdSocket struct {
+	name string
+	file *os.File
+	used bool
+}
+
+var (
+	systemdSocketsOnce sync.Once
+	systemdSockets     []*systemdSocket
+)
+
+// inheritedSockets returns the sockets systemd passed to this process through
+// LISTEN_FDS and LISTEN_FDNAMES. Like sd_listen_fds(3) it unsets those
+// variables, so they are only read once and aren't inherited by children.
+func inheritedSockets() []*systemdSocket {
+	systemdSocketsOnce.Do(func() {
+		defer os.Unsetenv("LISTEN_PID")
+		defer os.Unsetenv("LISTEN_FDS")
+		defer os.Unsetenv("LISTEN_FDNAMES")
+
+		if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+			return
+		}
+
+		n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || n <= 0 {
+			return
+		}
+
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < n; i++ {
+			fd := SD_LISTEN_FDS_START + i
+			syscall.CloseOnExec(fd)
+
+			name := strconv.Itoa(i)
+			if i < len(names) && names[i] != "" {
+				name = names[i]
+			}
+			systemdSockets = append(systemdSockets, &systemdSocket{name: name, file: os.NewFile(uintptr(fd), name)})
+		}
+	})
+
+	return systemdSockets
+}
+
+// datagram reports whether the inherited socket is packet, rather than
+// connection, oriented.
+func (s *systemdSocket) datagram() (bool, error) {
+	t, err := syscall.GetsockoptInt(int(s.file.Fd()), syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return false, err
+	}
+	return t == syscall.SOCK_DGRAM, nil
+}
+
+// localAddr returns the address the inherited socket is bound to
+func (s *systemdSocket) localAddr() string {
+	sa, err := syscall.Getsockname(int(s.file.Fd()))
+	if err != nil {
+		return ""
+	}
+
+	switch sa := sa.(type) {
+	case *syscall.SockaddrUnix:
+		return sa.Name
+	case *syscall.SockaddrInet4:
+		return net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	case *syscall.SockaddrInet6:
+		return net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	}
+	return ""
+}
+
+// adopt turns the inherited socket into a listener, or a packet conn for a
+// datagram socket.
+func (s *systemdSocket) adopt() (net.Listener, net.PacketConn, error) {
+	s.used = true
+	defer s.file.Close()
+
+	datagram, err := s.datagram()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if datagram {
+		conn, err := net.FilePacketConn(s.file)
+		return nil, conn, err
+	}
+
+	listener, err := net.FileListener(s.file)
+	return listener, nil, err
+}
+
+// findInheritedSocket returns the unused inherited socket for addr. A
+// systemd address names the socket by its FileDescriptorName= or index,
+// any other address matches a socket already bound to it.
+func findInheritedSocket(addr listenAddr) *systemdSocket {
+	for _, s := range inheritedSockets() {
+		if s.used {
+			continue
+		}
+		if addr.network == "systemd" && s.name == addr.address {
+			return s
+		}
+		if addr.network != "systemd" && s.localAddr() == addr.address {
+			return s
+		}
+	}
+	return nil
+}
+
+// SdNotify sends state to the service manager, as sd_notify(3) does. It
+// does nothing if shh wasn't started with NOTIFY_SOCKET.
+func SdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// SdWatchdogInterval returns how often WATCHDOG=1 should be sent to the
+// service manager, which is half of WATCHDOG_USEC, or 0 if the watchdog
+// isn't enabled for this process.
+func SdWatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", usec)
+	}
+
+	return time.Duration(n) * time.Microsecond / 2, nil
+}
@@ -0,0 +1,112 @@
+package shh
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSdNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := SdNotify("READY=1"); err != nil {
+		t.Errorf("Should do nothing without NOTIFY_SOCKET, got=%s", err)
+	}
+
+	sock := filepath.Join(dir, "notify")
+	conn, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", sock)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	if err := SdNotify("READY=1\nSTATUS=testing"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "READY=1\nSTATUS=testing" {
+		t.Errorf("Unexpected notification: %q", got)
+	}
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+
+	if d, err := SdWatchdogInterval(); d != 0 || err != nil {
+		t.Errorf("Should be disabled without WATCHDOG_USEC, got=%s, %v", d, err)
+	}
+
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	if d, err := SdWatchdogInterval(); d != 15*time.Second || err != nil {
+		t.Errorf("Should be half of WATCHDOG_USEC, got=%s, %v", d, err)
+	}
+
+	os.Setenv("WATCHDOG_USEC", "soon")
+	if _, err := SdWatchdogInterval(); err == nil {
+		t.Errorf("An invalid WATCHDOG_USEC should have failed")
+	}
+}
+
+func TestListenPoller_InheritedSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shh-systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "shh.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// systemd owns the socket path, so closing our copy mustn't remove it
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	f, err := l.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	systemdSocketsOnce.Do(func() {})
+	systemdSockets = []*systemdSocket{{name: "metrics", file: f}}
+	defer func() { systemdSockets = nil }()
+
+	measurements := make(chan Measurement, 1)
+	poller := NewListenPoller(measurements, Config{Listen: "systemd,metrics", ListenTimeout: 5 * time.Second})
+	defer poller.Exit()
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("90210 beverly.hills 10\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-measurements:
+		if m.Name("") != "listen.beverly.hills" {
+			t.Errorf("Expected listen.beverly.hills, got=%s", m.Name(""))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a measurement")
+	}
+}
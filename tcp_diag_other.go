@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package shh
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// dumpTcpDiag needs netlink, which is only available on Linux
+func dumpTcpDiag(states uint32, visit func(tcpSocket)) error {
+	return fmt.Errorf("netlink isn't available on %s", runtime.GOOS)
+}
@@ -0,0 +1,212 @@
+package shh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heroku/slog"
+)
+
+const (
+	TCP_DATA   = "/proc/net/tcp"
+	TCP6_DATA  = "/proc/net/tcp6"
+	TCP_LISTEN = 10
+)
+
+// States of TCP sockets, indexed by their number in include/net/tcp_states.h
+var tcpStates = []string{
+	"", "established", "syn-sent", "syn-recv", "fin-wait1", "fin-wait2", "time-wait",
+	"close", "close-wait", "last-ack", "listen", "closing",
+}
+
+// Ports are those in SHH_TCP_PORTS
+var tcpMetrics = []MetricDescriptor{
+	pollerErrorMetric("tcp"),
+	{"tcp.port.<port>.listen.queue.rx", GaugeType, Connections, "Connections waiting to be accepted by the port's LISTEN sockets", ""},
+	{"tcp.port.<port>.listen.backlog", GaugeType, Connections, "Most connections the port's LISTEN sockets queue to be accepted, only known with netlink", ""},
+	{"tcp.port.<port>.<state>", GaugeType, Sockets, "TCP sockets on the local port, by state", ""},
+	{"tcp.<state>", GaugeType, Sockets, "TCP sockets, by state", ""},
+}
+
+// tcpSocket is what the tcp poller needs to know about each socket
+type tcpSocket struct {
+	port   uint16
+	state  int
+	rx, tx uint64
+}
+
+// tcpPortCounts are the counts of sockets on a port, or on all of them
+type tcpPortCounts struct {
+	states  [12]uint64
+	rx      uint64
+	backlog uint64
+}
+
+type Tcp struct {
+	measurements chan<- Measurement
+	files        []string
+	ports        []uint16
+	netlink      bool
+}
+
+func NewTcpPoller(measurements chan<- Measurement, config Config) Tcp {
+	poller := Tcp{
+		measurements: measurements,
+		files:        []string{config.procNetPath(TCP_DATA), config.procNetPath(TCP6_DATA)},
+	}
+
+	for _, p := range config.TcpPorts {
+		if port, err := parseTcpPort(p); err == nil {
+			poller.ports = append(poller.ports, port)
+		}
+	}
+
+	// netlink only sees our own network namespace, so under another procfs
+	// read the files of its init instead
+	if config.TcpNetlink && (config.ProcRoot == "" || config.ProcRoot == DEFAULT_PROC_ROOT) {
+		// only dump the listening sockets to check netlink works, it's
+		// fine to fall back to the files on kernels without inet_diag
+		if err := dumpTcpDiag(1<<TCP_LISTEN, func(tcpSocket) {}); err != nil {
+			LogError(slog.Context{"poller": poller.Name(), "fn": "NewTcpPoller"}, err, "using netlink, reading "+TCP_DATA+" instead")
+		} else {
+			poller.netlink = true
+		}
+	}
+
+	return poller
+}
+
+func parseTcpPort(port string) (uint16, error) {
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err == nil && p == 0 {
+		err = fmt.Errorf("port 0")
+	}
+	return uint16(p), err
+}
+
+func (poller Tcp) Poll(tick time.Time) {
+	ctx := slog.Context{"poller": poller.Name(), "fn": "Poll", "tick": tick}
+
+	var all tcpPortCounts
+	ports := make(map[uint16]*tcpPortCounts, len(poller.ports))
+	for _, port := range poller.ports {
+		ports[port] = &tcpPortCounts{}
+	}
+
+	visit := func(socket tcpSocket) {
+		if socket.state <= 0 || socket.state >= len(tcpStates) {
+			return
+		}
+		all.states[socket.state]++
+
+		counts, ok := ports[socket.port]
+		if !ok {
+			return
+		}
+		counts.states[socket.state]++
+		// For LISTEN sockets, rx is the accept queue. Netlink gives the
+		// backlog as tx, while the files' tx_queue is always 0 for them.
+		if socket.state == TCP_LISTEN {
+			counts.rx += socket.rx
+			if poller.netlink {
+				counts.backlog += socket.tx
+			}
+		}
+	}
+
+	if poller.netlink {
+		if err := dumpTcpDiag(^uint32(0), visit); err != nil {
+			LogError(ctx, err, "dumping sockets with netlink")
+			poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
+			return
+		}
+	} else {
+		for _, file := range poller.files {
+			// tcp6 is missing when IPv6 is disabled
+			if err := readProcNetTcp(file, visit); err != nil && !os.IsNotExist(err) {
+				LogError(ctx, err, "reading "+file)
+				poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
+				return
+			}
+		}
+	}
+
+	poller.report(tick, nil, &all)
+	for _, port := range poller.ports {
+		counts := ports[port]
+		what := []string{"port", strconv.Itoa(int(port))}
+		poller.report(tick, what, counts)
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), append(what, "listen", "queue", "rx"), counts.rx, Connections}
+		if poller.netlink {
+			poller.measurements <- GaugeMeasurement{tick, poller.Name(), append(what, "listen", "backlog"), counts.backlog, Connections}
+		}
+	}
+}
+
+// report emits the count of sockets in every state, even when 0, named
+// after prefix.
+func (poller Tcp) report(tick time.Time, prefix []string, counts *tcpPortCounts) {
+	for state, name := range tcpStates {
+		if name == "" {
+			continue
+		}
+		what := append(append([]string{}, prefix...), name)
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), what, counts.states[state], Sockets}
+	}
+}
+
+// readProcNetTcp calls visit with each socket in file, with lines like
+// "0: 0100007F:1F90 00000000:0000 0A 00000000:00000001 ...", giving the
+// local and remote address and port, the state and the tx:rx queues, in hex.
+func readProcNetTcp(file string, visit func(tcpSocket)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // the header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		local := strings.SplitN(fields[1], ":", 2)
+		queues := strings.SplitN(fields[4], ":", 2)
+		if len(local) != 2 || len(queues) != 2 {
+			return fmt.Errorf("malformed line %q", scanner.Text())
+		}
+
+		port, err := strconv.ParseUint(local[1], 16, 16)
+		if err != nil {
+			return err
+		}
+		state, err := strconv.ParseUint(fields[3], 16, 8)
+		if err != nil {
+			return err
+		}
+		tx, err := strconv.ParseUint(queues[0], 16, 64)
+		if err != nil {
+			return err
+		}
+		rx, err := strconv.ParseUint(queues[1], 16, 64)
+		if err != nil {
+			return err
+		}
+
+		visit(tcpSocket{port: uint16(port), state: int(state), rx: rx, tx: tx})
+	}
+	return scanner.Err()
+}
+
+func (poller Tcp) Name() string {
+	return "tcp"
+}
+
+func (poller Tcp) Exit() {}
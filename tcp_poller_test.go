@@ -0,0 +1,84 @@
+package shh
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTcpPoller(t *testing.T) {
+	header := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+	root := newFixture(t, map[string]string{
+		"proc/1/net/tcp": header +
+			"   0: 00000000:1388 00000000:0000 0A 00000000:00000003 00:00000000 00000000  1000        0 1 1 0 100 0 0 10 0\n" +
+			"   1: 0100007F:1388 0100007F:C350 01 00000000:00000000 00:00000000 00000000  1000        0 2 1 0 20 4 30 10 -1\n" +
+			"   2: 0100007F:1388 0100007F:C351 06 00000000:00000000 03:00000F00 00000000     0        0 0 3 0\n" +
+			"   3: 0100007F:C352 0100007F:1920 08 00000000:00000000 00:00000000 00000000  1000        0 3 1 0 20 4 30 10 -1\n",
+		"proc/1/net/tcp6": header +
+			"   0: 00000000000000000000000000000000:1388 00000000000000000000000000000000:0000 0A 00000000:00000002 00:00000000 00000000  1000        0 4 1 0 100 0 0 10 0\n",
+		// our own network namespace, rather than that of the root's init
+		"proc/net/tcp": header +
+			"   0: 00000000:1920 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 5 1 0 100 0 0 10 0\n",
+	})
+
+	poller := NewTcpPoller(nil, Config{ProcRoot: root + "/proc", TcpPorts: []string{"5000", "6432"}, TcpNetlink: true})
+	if poller.netlink {
+		t.Errorf("Should not have used netlink, which can't see the root's network namespace")
+	}
+	values := pollValues(t, func(measurements chan<- Measurement) {
+		poller.measurements = measurements
+		poller.Poll(time.Now())
+	})
+
+	expected := map[string]string{
+		"tcp.listen":                    "2",
+		"tcp.established":               "1",
+		"tcp.time-wait":                 "1",
+		"tcp.close-wait":                "1",
+		"tcp.syn-sent":                  "0",
+		"tcp.port.5000.listen":          "2",
+		"tcp.port.5000.established":     "1",
+		"tcp.port.5000.time-wait":       "1",
+		"tcp.port.5000.close-wait":      "0",
+		"tcp.port.5000.listen.queue.rx": "5",
+		"tcp.port.6432.established":     "0",
+		"tcp.port.6432.listen.queue.rx": "0",
+		"tcp.port.6432.listen":          "0",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+	for _, name := range []string{"tcp.error", "tcp.port.5000.listen.backlog", "tcp.port.5000.listen.queue.tx"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("Should not have reported %s", name)
+		}
+	}
+}
+
+func TestTcpPoller_Netlink(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+
+	poller := NewTcpPoller(nil, Config{ProcRoot: DEFAULT_PROC_ROOT, TcpPorts: []string{port}, TcpNetlink: true})
+	if !poller.netlink {
+		t.Skip("netlink inet_diag isn't available")
+	}
+	values := pollValues(t, func(measurements chan<- Measurement) {
+		poller.measurements = measurements
+		poller.Poll(time.Now())
+	})
+
+	if values["tcp.port."+port+".listen"] != "1" {
+		t.Errorf("Should have counted the listener, got %q", values["tcp.port."+port+".listen"])
+	}
+	if b, ok := values["tcp.port."+port+".listen.backlog"]; !ok || b == "0" {
+		t.Errorf("Should have reported the listener's backlog")
+	}
+}
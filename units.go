@@ -11,15 +11,18 @@ var (
 	Bytes           = Unit{"Bytes", "b"}
 	Seconds         = Unit{"Seconds", "s"}
 	MilliSeconds    = Unit{"MilliSeconds", "ms"}
+	MicroSeconds    = Unit{"MicroSeconds", "us"}
 	NanoSeconds     = Unit{"NanoSeconds", "ns"}
 	Requests        = Unit{"Requests", "reqs"}
 	Errors          = Unit{"Errors", "errs"}
 	Packets         = Unit{"Packets", "pkts"}
+	Mbps            = Unit{"MegabitsPerSecond", "Mbps"}
 	INodes          = Unit{"INodes", "inodes"}
 	Files           = Unit{"Files", "files"}
 	Processes       = Unit{"Processes", "procs"}
 	Threads         = Unit{"Threads", "threads"}
 	Connections     = Unit{"Connections", "conns"}
+	Containers      = Unit{"Containers", "containers"}
 	Sockets         = Unit{"Sockets", "socks"}
 	Avg             = Unit{"Avg", "avg"}
 	Objects         = Unit{"Objects", "objs"}
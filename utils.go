@@ -1,10 +1,13 @@
 package shh
 
 import (
+	"fmt"
 	"log"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -14,17 +17,29 @@ import (
 	"github.com/heroku/slog"
 )
 
+const (
+	REGEXP_PREFIX = "re:" // SHH_CGROUPS and SHH_NIF_DEVICES entries starting with this are regexps
+)
+
 var (
 	NonWord = regexp.MustCompile("\\W")
 )
 
+// FatalError logs err and exits, unless CollectOnce is running, in which
+// case only the calling goroutine is stopped and its poller reported as
+// failed.
 func FatalError(ctx slog.Context, err error, msg interface{}) {
 	ctx["error"] = err
 	ctx["message"] = msg
+	if failures.record(ctx, err) {
+		ErrLogger.Println(ctx)
+		runtime.Goexit()
+	}
 	ErrLogger.Fatal(ctx)
 }
 
 func LogError(ctx slog.Context, err error, msg interface{}) {
+	failures.record(ctx, err)
 	ctx["error"] = err
 	ctx["message"] = msg
 	ErrLogger.Println(ctx)
@@ -82,12 +97,52 @@ func Atouint64(s string) uint64 {
 	return val
 }
 
+// isGlob reports whether the entry s of a setting like SHH_CGROUPS is a glob,
+// such as system.slice/*.service
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// compilePatternRegexp compiles the entry s of a setting like SHH_CGROUPS, a
+// regexp prefixed with re:, which has to match the whole of a name.
+func compilePatternRegexp(s string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + strings.TrimPrefix(s, REGEXP_PREFIX) + ")$")
+}
+
+// checkPattern returns an error if the entry s of a setting like SHH_CGROUPS
+// is an invalid glob or regexp.
+func checkPattern(s string) error {
+	switch {
+	case strings.HasPrefix(s, REGEXP_PREFIX):
+		_, err := compilePatternRegexp(s)
+		return err
+	case isGlob(s):
+		if _, err := filepath.Match(s, ""); err != nil {
+			return fmt.Errorf("%q: %s", s, err)
+		}
+	}
+	return nil
+}
+
 // Checks to see if a path exists or not
 func Exists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
 }
 
+// Moves path, a location under the default root def, under root instead.
+// Paths outside of def, and an empty root, leave path unchanged.
+func rebasePath(path, def, root string) string {
+	if root == "" || root == def {
+		return path
+	}
+	rel, err := filepath.Rel(def, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.Join(root, rel)
+}
+
 // Returns the value of $env from the OS and if it's empty, returns def
 func GetEnvWithDefault(env string, def string) string {
 	tmp := os.Getenv(env)
@@ -101,50 +156,54 @@ func GetEnvWithDefault(env string, def string) string {
 
 // Returns the value of $env from the OS and if it's empty, returns def
 func GetEnvWithDefaultInt(env string, def int) int {
-	tmp := os.Getenv(env)
-
-	if tmp == "" {
-		return def
-	}
-
-	i, err := strconv.Atoi(tmp)
+	i, err := envInt(env, def)
 	if err != nil {
 		FatalError(slog.Context{"fn": "GetEnvWithDefaultInt", "env": env, "def": def}, err, "converting atoi")
 	}
 	return i
 }
 
-// Returns the value of $env from the OS and if it's empty, returns def
-func GetEnvWithDefaultBool(env string, def bool) bool {
+func envInt(env string, def int) (int, error) {
 	tmp := os.Getenv(env)
 
 	if tmp == "" {
-		return def
+		return def, nil
 	}
 
-	b, err := strconv.ParseBool(tmp)
+	return strconv.Atoi(tmp)
+}
+
+// Returns the value of $env from the OS and if it's empty, returns def
+func GetEnvWithDefaultBool(env string, def bool) bool {
+	b, err := envBool(env, def)
 	if err != nil {
 		FatalError(slog.Context{"fn": "GetEnvWithDefaultBool", "env": env, "def": def}, err, "converting atob")
 	}
 	return b
 }
 
-func GetEnvWithDefaultDuration(env string, def string) time.Duration {
+func envBool(env string, def bool) (bool, error) {
 	tmp := os.Getenv(env)
 
 	if tmp == "" {
-		tmp = def
+		return def, nil
 	}
 
-	d, err := time.ParseDuration(tmp)
+	return strconv.ParseBool(tmp)
+}
 
+func GetEnvWithDefaultDuration(env string, def string) time.Duration {
+	d, err := envDuration(env, def)
 	if err != nil {
 		FatalError(slog.Context{"fn": "GetEnvWithDefaultDuration", "env": env, "def": def}, err, "not a valid duration")
 	}
-
 	return d
 }
 
+func envDuration(env string, def string) (time.Duration, error) {
+	return time.ParseDuration(GetEnvWithDefault(env, def))
+}
+
 // Returns a slice of sorted strings from the environment or default split on ,
 // So "foo,bar" returns ["bar","foo"]
 func GetEnvWithDefaultStrings(env string, def string) []string {
@@ -161,26 +220,33 @@ func GetEnvWithDefaultStrings(env string, def string) []string {
 
 // Returns a *regexp.Regexp compiled from the env or default
 func GetEnvWithDefaultRegexp(env string, def string) *regexp.Regexp {
-	env = GetEnvWithDefault(env, def)
-	re, err := regexp.Compile(env)
+	re, err := envRegexp(env, def)
 	if err != nil {
-		FatalError(slog.Context{"fn": "GetEnvWithDefaultRegexp", "env": env, "def": def}, err, "not a valid regex")
+		FatalError(slog.Context{"fn": "GetEnvWithDefaultRegexp", "env": GetEnvWithDefault(env, def), "def": def}, err, "not a valid regex")
 	}
 	return re
 }
 
+func envRegexp(env string, def string) (*regexp.Regexp, error) {
+	return regexp.Compile(GetEnvWithDefault(env, def))
+}
+
 // Returns a *url.URL representing the given env, or nil if empty
 func GetEnvWithDefaultURL(env string, def string) *url.URL {
+	parsed, err := envURL(env, def)
+	if err != nil {
+		FatalError(slog.Context{"fn": "GetEnvWithDefaultURL", "env": GetEnvWithDefault(env, def), "def": def}, err, "not a valid URL")
+	}
+	return parsed
+}
+
+func envURL(env string, def string) (*url.URL, error) {
 	env = GetEnvWithDefault(env, def)
 	if env == "" {
-		return nil
+		return nil, nil
 	}
 
-	parsed, err := url.Parse(env)
-	if err != nil {
-		FatalError(slog.Context{"fn": "GetEnvWithDefaultURL", "env": env, "def": def}, err, "not a valid URL")
-	}
-	return parsed
+	return url.Parse(env)
 }
 
 // Small wrapper to handle errors on open
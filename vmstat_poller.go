@@ -0,0 +1,112 @@
+package shh
+
+import (
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/heroku/slog"
+)
+
+const (
+	VMSTAT_DATA = "/proc/vmstat"
+)
+
+var (
+	VMSTAT_MINIMAL_LIST     = []string{"pgpgin", "pgpgout", "pswpin", "pswpout", "pgmajfault", "oom_kill"}
+	VMSTAT_MINIMAL_PREFIXES = []string{"pgscan_", "pgsteal_", "thp_"}
+)
+
+// Fields of /proc/vmstat starting with nr_ are current counts, reported as
+// gauges, except for these
+var vmstatNrCounters = []string{"nr_dirtied", "nr_written"}
+
+// Fields of /proc/vmstat have _ replaced by .
+var vmstatMetrics = []MetricDescriptor{
+	pollerErrorMetric("vmstat"),
+	{"vmstat.pgpgin", CounterType, Bytes, "Data paged in from disk", ""},
+	{"vmstat.pgpgout", CounterType, Bytes, "Data paged out to disk", ""},
+	{"vmstat.pswpin", CounterType, Empty, "Pages swapped in", ""},
+	{"vmstat.pswpout", CounterType, Empty, "Pages swapped out", ""},
+	{"vmstat.pgmajfault", CounterType, Faults, "Major page faults, needing disk IO", ""},
+	{"vmstat.pgscan.<field>", CounterType, Empty, "Pages scanned for reclaim, by kswapd or directly by allocations", ""},
+	{"vmstat.pgsteal.<field>", CounterType, Empty, "Pages reclaimed, by kswapd or directly by allocations", ""},
+	{"vmstat.oom.kill", CounterType, Empty, "Processes killed by the OOM killer", ""},
+	{"vmstat.thp.<field>", CounterType, Empty, "Transparent huge page events", ""},
+	{"vmstat.pgfault", CounterType, Faults, "Page faults", "SHH_FULL=vmstat"},
+	{"vmstat.nr.dirtied", CounterType, Empty, "Pages dirtied", "SHH_FULL=vmstat"},
+	{"vmstat.nr.written", CounterType, Empty, "Pages written back", "SHH_FULL=vmstat"},
+	{"vmstat.nr.<field>", GaugeType, Empty, "A current count of pages, from /proc/vmstat", "SHH_FULL=vmstat"},
+	{"vmstat.<field>", CounterType, Empty, "Any other field of /proc/vmstat", "SHH_FULL=vmstat"},
+}
+
+type Vmstat struct {
+	measurements chan<- Measurement
+	full         bool
+	data         string
+}
+
+func NewVmstatPoller(measurements chan<- Measurement, config Config) Vmstat {
+	poller := Vmstat{
+		measurements: measurements,
+		data:         config.procPath(VMSTAT_DATA),
+	}
+	poller.full = SliceContainsString(config.Full, poller.Name())
+	return poller
+}
+
+// https://www.kernel.org/doc/Documentation/sysctl/vm.txt
+func (poller Vmstat) Poll(tick time.Time) {
+	ctx := slog.Context{"poller": poller.Name(), "fn": "Poll", "tick": tick}
+
+	data, err := ioutil.ReadFile(poller.data)
+	if err != nil {
+		LogError(ctx, err, "reading "+poller.data)
+		poller.measurements <- GaugeMeasurement{tick, poller.Name(), []string{"error"}, 1, Errors}
+		return
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		field := fields[0]
+		value := Atouint64(fields[1])
+
+		if !poller.full && !vmstatMinimal(field) {
+			continue
+		}
+
+		switch {
+		case field == "pgpgin" || field == "pgpgout":
+			// in kB, as for /proc/meminfo
+			poller.measurements <- CounterMeasurement{tick, poller.Name(), FixUpName(field), value * 1024, Bytes}
+		case field == "pgmajfault" || field == "pgfault":
+			poller.measurements <- CounterMeasurement{tick, poller.Name(), FixUpName(field), value, Faults}
+		case strings.HasPrefix(field, "nr_") && !SliceContainsString(vmstatNrCounters, field):
+			poller.measurements <- GaugeMeasurement{tick, poller.Name(), FixUpName(field), value, Empty}
+		default:
+			poller.measurements <- CounterMeasurement{tick, poller.Name(), FixUpName(field), value, Empty}
+		}
+	}
+}
+
+// vmstatMinimal reports whether field is reported by default
+func vmstatMinimal(field string) bool {
+	if SliceContainsString(VMSTAT_MINIMAL_LIST, field) {
+		return true
+	}
+	for _, prefix := range VMSTAT_MINIMAL_PREFIXES {
+		if strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (poller Vmstat) Name() string {
+	return "vmstat"
+}
+
+func (poller Vmstat) Exit() {}
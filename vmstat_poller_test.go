@@ -0,0 +1,61 @@
+package shh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVmstatPoller(t *testing.T) {
+	root := newFixture(t, map[string]string{
+		"proc/vmstat": "nr_free_pages 1000\nnr_dirtied 20\npgpgin 4\npgpgout 8\npswpin 1\npswpout 2\npgfault 300\npgmajfault 30\n" +
+			"pgscan_kswapd 5\npgscan_direct_throttle 0\npgsteal_direct 6\noom_kill 1\nthp_fault_alloc 7\ncompact_stall 9\n",
+	})
+
+	config := Config{ProcRoot: root + "/proc"}
+	values := pollValues(t, func(measurements chan<- Measurement) {
+		NewVmstatPoller(measurements, config).Poll(time.Now())
+	})
+	expected := map[string]string{
+		"vmstat.pgpgin":                 "4096",
+		"vmstat.pgpgout":                "8192",
+		"vmstat.pswpin":                 "1",
+		"vmstat.pswpout":                "2",
+		"vmstat.pgmajfault":             "30",
+		"vmstat.pgscan.kswapd":          "5",
+		"vmstat.pgscan.direct.throttle": "0",
+		"vmstat.pgsteal.direct":         "6",
+		"vmstat.oom.kill":               "1",
+		"vmstat.thp.fault.alloc":        "7",
+	}
+	if len(values) != len(expected) {
+		t.Errorf("Should have reported %d metrics, got %v", len(expected), values)
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+
+	config.Full = []string{"vmstat"}
+	values = pollValues(t, func(measurements chan<- Measurement) {
+		NewVmstatPoller(measurements, config).Poll(time.Now())
+	})
+	expected = map[string]string{
+		"vmstat.nr.free.pages": "1000",
+		"vmstat.nr.dirtied":    "20",
+		"vmstat.pgfault":       "300",
+		"vmstat.compact.stall": "9",
+		"vmstat.pgmajfault":    "30",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Should have reported %s=%s, got %q", name, value, values[name])
+		}
+	}
+}
+
+func TestVmstatPoller_Unavailable(t *testing.T) {
+	checkPollError(t, "vmstat", func(measurements chan<- Measurement) {
+		NewVmstatPoller(measurements, Config{ProcRoot: "/nonexistent"}).Poll(time.Now())
+	})
+}